@@ -46,6 +46,29 @@ func TestGetMiss(t *testing.T, cache imageserver_cache.Cache) {
 	}
 }
 
+// TestDelete is a helper to test imageserver/cache.Deleter.Delete().
+func TestDelete(t *testing.T, cache imageserver_cache.Cache) {
+	err := cache.Set(KeyValid, testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageserver_cache.Delete(cache, KeyValid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := cache.Get(KeyValid, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != nil {
+		t.Fatal("image not nil")
+	}
+	err = imageserver_cache.Delete(cache, KeyMiss)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // MapCache is a simple imageserver/cache.Cache implementation (it wraps a map) for tests.
 type MapCache struct {
 	mutex sync.RWMutex
@@ -73,3 +96,11 @@ func (cache *MapCache) Set(key string, im *imageserver.Image, params imageserver
 	cache.data[key] = im
 	return nil
 }
+
+// Delete implements imageserver/cache.Deleter.
+func (cache *MapCache) Delete(key string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	delete(cache.data, key)
+	return nil
+}
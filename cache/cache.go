@@ -2,6 +2,10 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"sync"
+
 	"github.com/pierrre/imageserver"
 )
 
@@ -16,7 +20,86 @@ type Cache interface {
 	Set(key string, image *imageserver.Image, params imageserver.Params) error
 }
 
+// ContextCache is a Cache that supports a context.Context.
+type ContextCache interface {
+	// GetContext is like Cache.Get() with a context.Context.
+	GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error)
+
+	// SetContext is like Cache.Set() with a context.Context.
+	SetContext(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error
+}
+
+// Deleter is a Cache that supports deletion.
+//
+// It allows to invalidate an Image (e.g. if the source has been modified).
+type Deleter interface {
+	// Delete removes the Image associated to the key.
+	// It doesn't return an error if the key doesn't exist.
+	Delete(key string) error
+}
+
+// ErrDeleteNotSupported is returned by Delete if the Cache doesn't implement Deleter.
+var ErrDeleteNotSupported = errors.New("cache: delete not supported")
+
+// Delete calls Deleter.Delete() if the Cache implements it.
+//
+// It returns ErrDeleteNotSupported otherwise.
+func Delete(c Cache, key string) error {
+	d, ok := c.(Deleter)
+	if !ok {
+		return ErrDeleteNotSupported
+	}
+	return d.Delete(key)
+}
+
+// GetWithContext calls Cache.Get() with a context.Context.
+//
+// If the Cache implements ContextCache, GetContext() is called.
+// Otherwise, the context is checked before calling Get().
+func GetWithContext(ctx context.Context, c Cache, key string, params imageserver.Params) (*imageserver.Image, error) {
+	if cc, ok := c.(ContextCache); ok {
+		return cc.GetContext(ctx, key, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Get(key, params)
+}
+
+// SetWithContext calls Cache.Set() with a context.Context.
+//
+// If the Cache implements ContextCache, SetContext() is called.
+// Otherwise, the context is checked before calling Set().
+func SetWithContext(ctx context.Context, c Cache, key string, image *imageserver.Image, params imageserver.Params) error {
+	if cc, ok := c.(ContextCache); ok {
+		return cc.SetContext(ctx, key, image, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Set(key, image, params)
+}
+
+// ContextAdapter is a Cache implementation that wraps a ContextCache.
+//
+// Calls to Get() and Set() use context.Background().
+type ContextAdapter struct {
+	ContextCache
+}
+
+// Get implements Cache.
+func (c *ContextAdapter) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	return c.ContextCache.GetContext(context.Background(), key, params)
+}
+
+// Set implements Cache.
+func (c *ContextAdapter) Set(key string, image *imageserver.Image, params imageserver.Params) error {
+	return c.ContextCache.SetContext(context.Background(), key, image, params)
+}
+
 // IgnoreError is a Cache implementation that ignores error from the underlying Cache.
+//
+// Delete doesn't ignore the error, because a failed delete must not be reported as a success (e.g. purge).
 type IgnoreError struct {
 	Cache
 }
@@ -36,25 +119,117 @@ func (c *IgnoreError) Set(key string, image *imageserver.Image, params imageserv
 	return nil
 }
 
+// GetContext implements ContextCache.
+func (c *IgnoreError) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	im, err := GetWithContext(ctx, c.Cache, key, params)
+	if err != nil {
+		return nil, nil
+	}
+	return im, nil
+}
+
+// SetContext implements ContextCache.
+func (c *IgnoreError) SetContext(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error {
+	SetWithContext(ctx, c.Cache, key, image, params)
+	return nil
+}
+
+// Delete implements Deleter.
+func (c *IgnoreError) Delete(key string) error {
+	return Delete(c.Cache, key)
+}
+
 // Async is an asynchronous Cache implementation.
 //
 // The Images are set from a new goroutine.
 type Async struct {
 	Cache
+
+	mu      sync.Mutex
+	pending map[string]*asyncPending
+}
+
+// asyncPending tracks the Set calls that are in flight for a key.
+type asyncPending struct {
+	wg    sync.WaitGroup
+	count int
 }
 
 // Set implements Cache.
 func (a *Async) Set(key string, image *imageserver.Image, params imageserver.Params) error {
+	p := a.addPending(key)
 	go func() {
+		defer a.donePending(key, p)
 		a.Cache.Set(key, image, params)
 	}()
 	return nil
 }
 
+func (a *Async) addPending(key string) *asyncPending {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending == nil {
+		a.pending = make(map[string]*asyncPending)
+	}
+	p, ok := a.pending[key]
+	if !ok {
+		p = new(asyncPending)
+		a.pending[key] = p
+	}
+	p.count++
+	p.wg.Add(1)
+	return p
+}
+
+func (a *Async) donePending(key string, p *asyncPending) {
+	a.mu.Lock()
+	p.count--
+	if p.count == 0 {
+		delete(a.pending, key)
+	}
+	a.mu.Unlock()
+	p.wg.Done()
+}
+
+// GetContext implements ContextCache.
+func (a *Async) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	return GetWithContext(ctx, a.Cache, key, params)
+}
+
+// SetContext implements ContextCache.
+//
+// The context is not forwarded, because the Image is set after the request is done.
+func (a *Async) SetContext(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error {
+	return a.Set(key, image, params)
+}
+
+// Delete implements Deleter.
+//
+// It waits for the Set calls of the key that are in flight, then deletes the Image synchronously,
+// so it is not returned by the Cache after the call (unless it is set again).
+func (a *Async) Delete(key string) error {
+	a.mu.Lock()
+	p := a.pending[key]
+	a.mu.Unlock()
+	if p != nil {
+		p.wg.Wait()
+	}
+	return Delete(a.Cache, key)
+}
+
 // Func is a Cache implementation that forwards calls to user defined functions
+//
+// GetContextFunc and SetContextFunc are optional.
+// If they are not set, the context is checked and then GetFunc and SetFunc are called.
+//
+// DeleteFunc is optional.
+// If it is not set, Delete returns ErrDeleteNotSupported.
 type Func struct {
-	GetFunc func(key string, params imageserver.Params) (*imageserver.Image, error)
-	SetFunc func(key string, image *imageserver.Image, params imageserver.Params) error
+	GetFunc        func(key string, params imageserver.Params) (*imageserver.Image, error)
+	SetFunc        func(key string, image *imageserver.Image, params imageserver.Params) error
+	GetContextFunc func(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error)
+	SetContextFunc func(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error
+	DeleteFunc     func(key string) error
 }
 
 // Get implements Cache.
@@ -66,3 +241,33 @@ func (c *Func) Get(key string, params imageserver.Params) (*imageserver.Image, e
 func (c *Func) Set(key string, image *imageserver.Image, params imageserver.Params) error {
 	return c.SetFunc(key, image, params)
 }
+
+// GetContext implements ContextCache.
+func (c *Func) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	if c.GetContextFunc != nil {
+		return c.GetContextFunc(ctx, key, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetFunc(key, params)
+}
+
+// SetContext implements ContextCache.
+func (c *Func) SetContext(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error {
+	if c.SetContextFunc != nil {
+		return c.SetContextFunc(ctx, key, image, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.SetFunc(key, image, params)
+}
+
+// Delete implements Deleter.
+func (c *Func) Delete(key string) error {
+	if c.DeleteFunc == nil {
+		return ErrDeleteNotSupported
+	}
+	return c.DeleteFunc(key)
+}
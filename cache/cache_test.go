@@ -1,8 +1,10 @@
 package cache_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/pierrre/imageserver"
 	. "github.com/pierrre/imageserver/cache"
@@ -73,3 +75,150 @@ func TestAsyncGetSet(t *testing.T) {
 }
 
 var _ Cache = &Func{}
+
+var _ ContextCache = &IgnoreError{}
+var _ ContextCache = &Async{}
+var _ ContextCache = &Func{}
+var _ Cache = &ContextAdapter{}
+
+func TestGetWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := cachetest.NewMapCache()
+	_, err := GetWithContext(ctx, c, "test", imageserver.Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = SetWithContext(ctx, c, "test", testdata.Medium, imageserver.Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFuncContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "foo")
+	c := &Func{
+		GetContextFunc: func(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+			if ctx.Value(ctxKey{}) != "foo" {
+				t.Fatal("context not forwarded")
+			}
+			return testdata.Medium, nil
+		},
+		SetContextFunc: func(ctx context.Context, key string, image *imageserver.Image, params imageserver.Params) error {
+			if ctx.Value(ctxKey{}) != "foo" {
+				t.Fatal("context not forwarded")
+			}
+			return nil
+		},
+	}
+	_, err := GetWithContext(ctx, &IgnoreError{Cache: c}, "test", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetWithContext(ctx, c, "test", testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextAdapter(t *testing.T) {
+	c := &ContextAdapter{ContextCache: &Func{
+		GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+			return testdata.Medium, nil
+		},
+		SetFunc: func(key string, image *imageserver.Image, params imageserver.Params) error {
+			return nil
+		},
+	}}
+	cachetest.TestGetSet(t, c)
+}
+
+var _ Deleter = &IgnoreError{}
+var _ Deleter = &Async{}
+var _ Deleter = &Func{}
+
+func TestDelete(t *testing.T) {
+	cachetest.TestDelete(t, cachetest.NewMapCache())
+}
+
+func TestDeleteNotSupported(t *testing.T) {
+	err := Delete(&Func{}, "test")
+	if err != ErrDeleteNotSupported {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestIgnoreErrorDelete(t *testing.T) {
+	cachetest.TestDelete(t, &IgnoreError{Cache: cachetest.NewMapCache()})
+	err := Delete(&IgnoreError{Cache: &Func{}}, "test")
+	if err != ErrDeleteNotSupported {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAsyncDelete(t *testing.T) {
+	mapCache := cachetest.NewMapCache()
+	mapCache.Set("foo", testdata.Small, imageserver.Params{})
+	err := Delete(&Async{Cache: mapCache}, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, _ := mapCache.Get("foo", imageserver.Params{})
+	if im != nil {
+		t.Fatal("image not nil")
+	}
+}
+
+func TestAsyncDeleteWaitsPendingSet(t *testing.T) {
+	mapCache := cachetest.NewMapCache()
+	block := make(chan struct{})
+	asyncCache := &Async{
+		Cache: &Func{
+			GetFunc: mapCache.Get,
+			SetFunc: func(key string, im *imageserver.Image, params imageserver.Params) error {
+				<-block
+				return mapCache.Set(key, im, params)
+			},
+			DeleteFunc: func(key string) error {
+				return Delete(mapCache, key)
+			},
+		},
+	}
+	asyncCache.Set("foo", testdata.Small, imageserver.Params{})
+	errCh := make(chan error)
+	go func() {
+		errCh <- asyncCache.Delete("foo")
+	}()
+	select {
+	case <-errCh:
+		t.Fatal("Delete didn't wait for the pending Set")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(block)
+	err := <-errCh
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, _ := mapCache.Get("foo", imageserver.Params{})
+	if im != nil {
+		t.Fatal("image not nil")
+	}
+}
+
+func TestFuncDelete(t *testing.T) {
+	called := false
+	c := &Func{
+		DeleteFunc: func(key string) error {
+			called = true
+			return nil
+		},
+	}
+	err := Delete(c, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("not called")
+	}
+}
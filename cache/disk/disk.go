@@ -0,0 +1,317 @@
+// Package disk provides an on-disk imageserver/cache.Cache implementation.
+package disk
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pierrre/imageserver"
+)
+
+const (
+	tempFilePrefix = ".tmp-"
+	checksumSize   = 4
+)
+
+// Cache is an on-disk imageserver/cache.Cache implementation.
+//
+// The Images are stored in files (Image.MarshalBinary with a checksum), in a sharded directory tree: "DIR/ab/cd/abcd...".
+// The file name is the SHA-256 hash of the key.
+//
+// The total size of the files is limited, and the least recently used files are removed first.
+// The index is kept in memory, and is rebuilt from the files on startup (the modification time gives the order).
+// The files are written atomically (temporary file + rename).
+// Corrupted files are removed, and are considered as a cache miss.
+type Cache struct {
+	dir      string
+	capacity int64
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	size  int64
+}
+
+type entry struct {
+	name string
+	size int64
+}
+
+// New creates a new Cache.
+//
+// dir is the directory that contains the files, it is created if necessary.
+// capacity is the maximum total size of the files (in bytes).
+func New(dir string, capacity int64) (*Cache, error) {
+	cache := &Cache{
+		dir:      dir,
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = cache.load()
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+type loadedFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+type byModTime []loadedFile
+
+func (s byModTime) Len() int           { return len(s) }
+func (s byModTime) Less(i, j int) bool { return s[i].modTime.Before(s[j].modTime) }
+func (s byModTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (cache *Cache) load() error {
+	var files []loadedFile
+	err := filepath.Walk(cache.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), tempFilePrefix) {
+			// Interrupted write.
+			return os.Remove(path)
+		}
+		if !isValidName(info.Name()) || path != cache.getPath(info.Name()) {
+			return nil
+		}
+		files = append(files, loadedFile{
+			name:    info.Name(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Sort(byModTime(files))
+	var evicted []string
+	cache.mu.Lock()
+	for _, f := range files {
+		evicted = append(evicted, cache.add(f.name, f.size)...)
+	}
+	cache.mu.Unlock()
+	cache.removeFiles(evicted)
+	return nil
+}
+
+// Get implements imageserver/cache.Cache.
+func (cache *Cache) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	name := getName(key)
+	cache.mu.Lock()
+	el, ok := cache.items[name]
+	if ok {
+		cache.ll.MoveToFront(el)
+	}
+	cache.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	path := cache.getPath(name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			cache.remove(name)
+			return nil, nil
+		}
+		return nil, err
+	}
+	im, ok := decode(data)
+	if !ok {
+		cache.remove(name)
+		os.Remove(path)
+		return nil, nil
+	}
+	// Keep the LRU order after a restart.
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return im, nil
+}
+
+// Set implements imageserver/cache.Cache.
+//
+// The Image is not stored if it is larger than the capacity.
+func (cache *Cache) Set(key string, im *imageserver.Image, params imageserver.Params) error {
+	data, err := encode(im)
+	if err != nil {
+		return err
+	}
+	size := int64(len(data))
+	if size > cache.capacity {
+		return nil
+	}
+	name := getName(key)
+	err = cache.write(name, data)
+	if err != nil {
+		return err
+	}
+	cache.mu.Lock()
+	evicted := cache.add(name, size)
+	cache.mu.Unlock()
+	cache.removeFiles(evicted)
+	return nil
+}
+
+func (cache *Cache) write(name string, data []byte) error {
+	path := cache.getPath(name)
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, tempFilePrefix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Delete implements imageserver/cache.Deleter.
+func (cache *Cache) Delete(key string) error {
+	name := getName(key)
+	cache.remove(name)
+	err := os.Remove(cache.getPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Size returns the total size of the files (in bytes).
+func (cache *Cache) Size() int64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.size
+}
+
+// Len returns the number of files.
+func (cache *Cache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.ll.Len()
+}
+
+// add adds (or updates) the entry, and returns the names of the evicted entries.
+//
+// The lock must be held.
+func (cache *Cache) add(name string, size int64) []string {
+	if el, ok := cache.items[name]; ok {
+		e := el.Value.(*entry)
+		cache.size += size - e.size
+		e.size = size
+		cache.ll.MoveToFront(el)
+	} else {
+		cache.items[name] = cache.ll.PushFront(&entry{name: name, size: size})
+		cache.size += size
+	}
+	var evicted []string
+	for cache.size > cache.capacity {
+		el := cache.ll.Back()
+		e := el.Value.(*entry)
+		cache.ll.Remove(el)
+		delete(cache.items, e.name)
+		cache.size -= e.size
+		evicted = append(evicted, e.name)
+	}
+	return evicted
+}
+
+func (cache *Cache) remove(name string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	el, ok := cache.items[name]
+	if !ok {
+		return
+	}
+	cache.ll.Remove(el)
+	delete(cache.items, name)
+	cache.size -= el.Value.(*entry).size
+}
+
+func (cache *Cache) removeFiles(names []string) {
+	for _, name := range names {
+		os.Remove(cache.getPath(name))
+	}
+}
+
+func (cache *Cache) getPath(name string) string {
+	return filepath.Join(cache.dir, name[0:2], name[2:4], name)
+}
+
+func getName(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+func isValidName(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+func encode(im *imageserver.Image) ([]byte, error) {
+	data, err := im.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var checksum [checksumSize]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(data))
+	return append(data, checksum[:]...), nil
+}
+
+func decode(data []byte) (*imageserver.Image, bool) {
+	if len(data) < checksumSize {
+		return nil, false
+	}
+	checksum := binary.BigEndian.Uint32(data[len(data)-checksumSize:])
+	data = data[:len(data)-checksumSize]
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, false
+	}
+	im := new(imageserver.Image)
+	err := im.UnmarshalBinaryNoCopy(data)
+	if err != nil {
+		return nil, false
+	}
+	return im, true
+}
@@ -0,0 +1,219 @@
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+	cachetest "github.com/pierrre/imageserver/cache/_test"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver_cache.Cache = &Cache{}
+
+var _ imageserver_cache.Deleter = &Cache{}
+
+func TestGetSet(t *testing.T) {
+	cache, dir := newTestCache(t, 20*1024*1024)
+	defer os.RemoveAll(dir)
+	cachetest.TestGetSet(t, cache)
+}
+
+func TestGetMiss(t *testing.T) {
+	cache, dir := newTestCache(t, 20*1024*1024)
+	defer os.RemoveAll(dir)
+	cachetest.TestGetMiss(t, cache)
+}
+
+func TestDelete(t *testing.T) {
+	cache, dir := newTestCache(t, 20*1024*1024)
+	defer os.RemoveAll(dir)
+	cachetest.TestDelete(t, cache)
+	if cache.Len() != 0 || cache.Size() != 0 {
+		t.Fatalf("unexpected len/size: %d/%d", cache.Len(), cache.Size())
+	}
+}
+
+func TestEviction(t *testing.T) {
+	size := getTestImageSize(t, testdata.Small)
+	cache, dir := newTestCache(t, size*2)
+	defer os.RemoveAll(dir)
+	for _, key := range []string{"a", "b"} {
+		err := cache.Set(key, testdata.Small, imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "a" is used, so "b" is the least recently used.
+	im, err := cache.Get("a", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im == nil {
+		t.Fatal("image nil")
+	}
+	err = cache.Set("c", testdata.Small, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 2 || cache.Size() != size*2 {
+		t.Fatalf("unexpected len/size: %d/%d", cache.Len(), cache.Size())
+	}
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		im, err := cache.Get(key, imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (im != nil) != expected {
+			t.Fatalf("unexpected presence of %s: %t", key, im != nil)
+		}
+	}
+	if _, err := os.Stat(cache.getPath(getName("b"))); !os.IsNotExist(err) {
+		t.Fatal("evicted file exists")
+	}
+}
+
+func TestSetTooLarge(t *testing.T) {
+	cache, dir := newTestCache(t, 10)
+	defer os.RemoveAll(dir)
+	err := cache.Set("a", testdata.Small, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("unexpected len: %d", cache.Len())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	size := getTestImageSize(t, testdata.Small)
+	cache, dir := newTestCache(t, size*3)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	for i, key := range []string{"a", "b", "c"} {
+		err := cache.Set(key, testdata.Small, imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(cache.getPath(getName(key)), modTime, modTime)
+	}
+	err := ioutil.WriteFile(filepath.Join(dir, tempFilePrefix+"interrupted"), []byte("foo"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The capacity is smaller, so the oldest file ("a") is evicted.
+	cache, err = New(dir, size*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 2 || cache.Size() != size*2 {
+		t.Fatalf("unexpected len/size: %d/%d", cache.Len(), cache.Size())
+	}
+	for key, expected := range map[string]bool{"a": false, "b": true, "c": true} {
+		im, err := cache.Get(key, imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (im != nil) != expected {
+			t.Fatalf("unexpected presence of %s: %t", key, im != nil)
+		}
+		if im != nil && !imageserver.ImageEqual(im, testdata.Small) {
+			t.Fatal("image not equals")
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, tempFilePrefix+"interrupted")); !os.IsNotExist(err) {
+		t.Fatal("temporary file exists")
+	}
+}
+
+func TestGetCorrupted(t *testing.T) {
+	for _, corrupt := range []func([]byte) []byte{
+		func(data []byte) []byte {
+			data[len(data)/2]++
+			return data
+		},
+		func(data []byte) []byte {
+			return data[:len(data)/2]
+		},
+		func(data []byte) []byte {
+			return data[:2]
+		},
+	} {
+		func() {
+			cache, dir := newTestCache(t, 20*1024*1024)
+			defer os.RemoveAll(dir)
+			err := cache.Set(cachetest.KeyValid, testdata.Small, imageserver.Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := cache.getPath(getName(cachetest.KeyValid))
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(path, corrupt(data), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			im, err := cache.Get(cachetest.KeyValid, imageserver.Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if im != nil {
+				t.Fatal("image not nil")
+			}
+			if cache.Len() != 0 {
+				t.Fatalf("unexpected len: %d", cache.Len())
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatal("corrupted file exists")
+			}
+		}()
+	}
+}
+
+func TestGetFileRemoved(t *testing.T) {
+	cache, dir := newTestCache(t, 20*1024*1024)
+	defer os.RemoveAll(dir)
+	err := cache.Set(cachetest.KeyValid, testdata.Small, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(cache.getPath(getName(cachetest.KeyValid)))
+	im, err := cache.Get(cachetest.KeyValid, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != nil {
+		t.Fatal("image not nil")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("unexpected len: %d", cache.Len())
+	}
+}
+
+func newTestCache(tb testing.TB, capacity int64) (*Cache, string) {
+	dir, err := ioutil.TempDir("", "imageserver_cache_disk")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cache, err := New(dir, capacity)
+	if err != nil {
+		os.RemoveAll(dir)
+		tb.Fatal(err)
+	}
+	return cache, dir
+}
+
+func getTestImageSize(tb testing.TB, im *imageserver.Image) int64 {
+	data, err := encode(im)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return int64(len(data))
+}
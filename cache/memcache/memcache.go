@@ -56,3 +56,12 @@ func (cache *Cache) setData(key string, data []byte) error {
 		Value: data,
 	})
 }
+
+// Delete implements imageserver/cache.Deleter.
+func (cache *Cache) Delete(key string) error {
+	err := cache.Client.Delete(key)
+	if err == memcache_impl.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
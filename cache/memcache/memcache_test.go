@@ -13,6 +13,8 @@ import (
 
 var _ imageserver_cache.Cache = &Cache{}
 
+var _ imageserver_cache.Deleter = &Cache{}
+
 func TestGetSet(t *testing.T) {
 	cache := newTestCache(t)
 	cachetest.TestGetSet(t, cache)
@@ -23,6 +25,11 @@ func TestGetMiss(t *testing.T) {
 	cachetest.TestGetMiss(t, cache)
 }
 
+func TestDelete(t *testing.T) {
+	cache := newTestCache(t)
+	cachetest.TestDelete(t, cache)
+}
+
 func TestGetErrorServer(t *testing.T) {
 	cache := newTestCacheInvalidServer(t)
 	_, err := cache.Get(cachetest.KeyValid, imageserver.Params{})
@@ -42,6 +42,12 @@ func (cache *Cache) Set(key string, image *imageserver.Image, params imageserver
 	return nil
 }
 
+// Delete implements imageserver/cache.Deleter.
+func (cache *Cache) Delete(key string) error {
+	cache.lru.Delete(key)
+	return nil
+}
+
 type item struct {
 	image *imageserver.Image
 }
@@ -9,6 +9,8 @@ import (
 
 var _ imageserver_cache.Cache = &Cache{}
 
+var _ imageserver_cache.Deleter = &Cache{}
+
 func TestGetSet(t *testing.T) {
 	cache := newTestCache()
 	cachetest.TestGetSet(t, cache)
@@ -19,6 +21,11 @@ func TestGetMiss(t *testing.T) {
 	cachetest.TestGetMiss(t, cache)
 }
 
+func TestDelete(t *testing.T) {
+	cache := newTestCache()
+	cachetest.TestDelete(t, cache)
+}
+
 func newTestCache() *Cache {
 	return New(20 * 1024 * 1024)
 }
@@ -68,3 +68,11 @@ func (cache *Cache) setData(key string, data []byte) error {
 	_, err := conn.Do("SET", params...)
 	return err
 }
+
+// Delete implements imageserver/cache.Deleter.
+func (cache *Cache) Delete(key string) error {
+	conn := cache.Pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", key)
+	return err
+}
@@ -14,6 +14,8 @@ import (
 
 var _ imageserver_cache.Cache = &Cache{}
 
+var _ imageserver_cache.Deleter = &Cache{}
+
 func TestGetSet(t *testing.T) {
 	cache := newTestCache(t)
 	defer cache.Pool.Close()
@@ -29,6 +31,12 @@ func TestGetMiss(t *testing.T) {
 	cachetest.TestGetMiss(t, cache)
 }
 
+func TestDelete(t *testing.T) {
+	cache := newTestCache(t)
+	defer cache.Pool.Close()
+	cachetest.TestDelete(t, cache)
+}
+
 func TestGetErrorAddress(t *testing.T) {
 	cache := newTestCacheInvalidAddress(t)
 	defer cache.Pool.Close()
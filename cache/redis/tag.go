@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"strconv"
+	"time"
+
+	redigo "github.com/garyburd/redigo/redis"
+)
+
+// TagIndex is a Redis imageserver/cache.TagIndex implementation.
+//
+// The keys of a tag are stored in a Redis set.
+type TagIndex struct {
+	Pool *redigo.Pool
+
+	// Prefix is added to the tag to get the Redis key of the set.
+	Prefix string
+
+	// Expire is an optional expiration duration of the set.
+	// It should be greater than or equal to the Cache expiration.
+	// It is rounded up to the second.
+	Expire time.Duration
+}
+
+// AddTags implements imageserver/cache.TagIndex.
+func (idx *TagIndex) AddTags(key string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	conn := idx.Pool.Get()
+	defer conn.Close()
+	expire := idx.getExpire()
+	for _, tag := range tags {
+		conn.Send("SADD", idx.Prefix+tag, key)
+		if expire > 0 {
+			conn.Send("EXPIRE", idx.Prefix+tag, strconv.Itoa(expire))
+		}
+	}
+	return doPipeline(conn)
+}
+
+// getExpire returns the expiration in seconds, rounded up (a sub-second value must not become 0, that deletes the set).
+func (idx *TagIndex) getExpire() int {
+	if idx.Expire <= 0 {
+		return 0
+	}
+	return int((idx.Expire + time.Second - 1) / time.Second)
+}
+
+// GetKeys implements imageserver/cache.TagIndex.
+func (idx *TagIndex) GetKeys(tag string) ([]string, error) {
+	conn := idx.Pool.Get()
+	defer conn.Close()
+	return redigo.Strings(conn.Do("SMEMBERS", idx.Prefix+tag))
+}
+
+// RemoveKeys implements imageserver/cache.TagIndex.
+//
+// Redis removes the set when it is empty.
+func (idx *TagIndex) RemoveKeys(tag string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	conn := idx.Pool.Get()
+	defer conn.Close()
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, idx.Prefix+tag)
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	_, err := conn.Do("SREM", args...)
+	return err
+}
+
+// doPipeline flushes the pipelined commands, and returns the first error reply.
+//
+// The error replies of a pipeline are returned as values, not as an error.
+func doPipeline(conn redigo.Conn) error {
+	replies, err := redigo.Values(conn.Do(""))
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(redigo.Error); ok {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+)
+
+var _ imageserver_cache.TagIndex = &TagIndex{}
+
+func TestTagIndex(t *testing.T) {
+	cache := newTestCache(t)
+	defer cache.Pool.Close()
+	idx := &TagIndex{
+		Pool:   cache.Pool,
+		Prefix: "test_tag:",
+	}
+	err := idx.AddTags("foo", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := idx.GetKeys("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "foo" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	err = idx.AddTags("bar", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.RemoveKeys("a", []string{"foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err = idx.GetKeys("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "bar" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	err = idx.RemoveKeys("a", []string{"bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.RemoveKeys("b", []string{"foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err = idx.GetKeys("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestTagIndexExpireSubSecond(t *testing.T) {
+	cache := newTestCache(t)
+	defer cache.Pool.Close()
+	idx := &TagIndex{
+		Pool:   cache.Pool,
+		Prefix: "test_tag_expire:",
+		Expire: 100 * time.Millisecond,
+	}
+	err := idx.AddTags("foo", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := idx.GetKeys("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestTagIndexErrorReply(t *testing.T) {
+	cache := newTestCache(t)
+	defer cache.Pool.Close()
+	conn := cache.Pool.Get()
+	_, err := conn.Do("SET", "test_tag_error:a", "not a set")
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &TagIndex{
+		Pool:   cache.Pool,
+		Prefix: "test_tag_error:",
+	}
+	err = idx.AddTags("foo", []string{"a"})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
@@ -1,10 +1,13 @@
 package cache
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"hash"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/pierrre/imageserver"
 )
@@ -13,37 +16,187 @@ import (
 //
 // Steps:
 //  - Generate the cache key.
-//  - Get the Image from the Cache, and return it if found.
+//  - Get the Image from the Cache, and return it if found (and fresh).
 //  - Get the Image from the Server.
 //  - Set the Image to the Cache.
+//  - Add the key to the TagIndex (optional).
 //  - Return the Image.
+//
+// If a TTL is set (with the "cache_ttl" param or TTLFunc), the stored time and the TTL are added to the Image metadata (see StoredMetadata and TTLMetadata).
+// An entry is fresh until its TTL expires. After that:
+//  - During StaleWhileRevalidate, the stale Image is returned, and it is refreshed in the background (once per key).
+//  - During StaleIfError, the Image is refreshed, but the stale Image is returned if the Server returns an error.
+//  - Then, the Image is refreshed.
+//
+// The entries without TTL never expire.
+// The Cache expiration (e.g. redis.Cache.Expire) should be greater than the TTL and the grace periods.
 type Server struct {
 	imageserver.Server
 	Cache        Cache
 	KeyGenerator KeyGenerator
+
+	// TagIndex is an optional index of the keys by tag.
+	// It allows to delete all the variants of a source with DeleteTag.
+	TagIndex TagIndex
+
+	// TagFuncs return the tags of an entry.
+	// Default: SourceTagFunc.
+	TagFuncs []TagFunc
+
+	// ErrorFunc is an optional function that is called if the key can not be added to the TagIndex.
+	// The Image is returned anyway, but the entry can not be deleted by tag.
+	ErrorFunc func(err error, params imageserver.Params)
+
+	// TTLFunc is an optional function that returns the TTL of an entry.
+	// The "cache_ttl" param has priority (see TTLParam).
+	// Zero means no expiration.
+	TTLFunc func(params imageserver.Params) time.Duration
+
+	// StaleWhileRevalidate is the grace period during which a stale Image is returned while it is refreshed in the background.
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError is the grace period during which a stale Image is returned if the Server returns an error.
+	// The StaleWhileRevalidate grace period is included in it.
+	StaleIfError time.Duration
+
+	// Now is an optional func that returns the current time.
+	// time.Now is used by default.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	refreshing map[string]struct{}
 }
 
 // Get implements imageserver.Server.
 func (s *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return s.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (s *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	ttl, err := s.getTTL(params)
+	if err != nil {
+		return nil, err
+	}
 	key := s.KeyGenerator.GetKey(params)
-	im, err := s.Cache.Get(key, params)
+	im, err := GetWithContext(ctx, s.Cache, key, params)
 	if err != nil {
 		return nil, err
 	}
-	if im != nil {
+	if im == nil {
+		return s.refresh(ctx, key, params, ttl)
+	}
+	stored, storedTTL, ok := getTTLMetadata(im)
+	if !ok {
+		return im, nil
+	}
+	age := s.now().Sub(stored)
+	if age < storedTTL {
+		return im, nil
+	}
+	if age < storedTTL+s.StaleWhileRevalidate {
+		s.refreshBackground(key, params, ttl)
 		return im, nil
 	}
-	im, err = s.Server.Get(params)
+	nim, err := s.refresh(ctx, key, params, ttl)
 	if err != nil {
+		if age < storedTTL+s.StaleIfError && err != ctx.Err() {
+			return im, nil
+		}
 		return nil, err
 	}
-	err = s.Cache.Set(key, im, params)
+	return nim, nil
+}
+
+// refresh gets the Image from the Server, and sets it to the Cache.
+func (s *Server) refresh(ctx context.Context, key string, params imageserver.Params, ttl time.Duration) (*imageserver.Image, error) {
+	im, err := imageserver.GetWithContext(ctx, s.Server, params)
 	if err != nil {
 		return nil, err
 	}
+	if ttl > 0 {
+		im = setTTLMetadata(im, s.now(), ttl)
+	}
+	err = SetWithContext(ctx, s.Cache, key, im, params)
+	if err != nil {
+		return nil, err
+	}
+	if s.TagIndex != nil {
+		err = s.TagIndex.AddTags(key, s.GetTags(params))
+		if err != nil && s.ErrorFunc != nil {
+			s.ErrorFunc(err, params)
+		}
+	}
 	return im, nil
 }
 
+// refreshBackground refreshes the Image from a new goroutine, if it is not already refreshing.
+//
+// The context is not forwarded, because the Image is refreshed after the request is done.
+// The error is ignored: the stale Image is kept in the Cache.
+func (s *Server) refreshBackground(key string, params imageserver.Params, ttl time.Duration) {
+	s.mu.Lock()
+	if s.refreshing == nil {
+		s.refreshing = make(map[string]struct{})
+	}
+	_, ok := s.refreshing[key]
+	if !ok {
+		s.refreshing[key] = struct{}{}
+	}
+	s.mu.Unlock()
+	if ok {
+		return
+	}
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.refreshing, key)
+			s.mu.Unlock()
+		}()
+		s.refresh(context.Background(), key, params, ttl)
+	}()
+}
+
+func (s *Server) getTTL(params imageserver.Params) (time.Duration, error) {
+	ttl, ok, err := GetTTLParam(params)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return ttl, nil
+	}
+	if s.TTLFunc != nil {
+		return s.TTLFunc(params), nil
+	}
+	return 0, nil
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// GetTags returns the tags of the Params.
+func (s *Server) GetTags(params imageserver.Params) []string {
+	tagFuncs := s.TagFuncs
+	if tagFuncs == nil {
+		tagFuncs = []TagFunc{SourceTagFunc}
+	}
+	return GetTags(tagFuncs, params)
+}
+
+// DeleteTag deletes all the entries associated to the tag.
+//
+// The TagIndex must be set, and the Cache must implement Deleter.
+func (s *Server) DeleteTag(tag string) error {
+	if s.TagIndex == nil {
+		return errors.New("cache: no tag index")
+	}
+	return DeleteTag(s.Cache, s.TagIndex, tag)
+}
+
 // KeyGenerator represents a Cache key generator.
 type KeyGenerator interface {
 	GetKey(imageserver.Params) string
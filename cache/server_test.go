@@ -1,6 +1,7 @@
 package cache_test
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"testing"
@@ -92,6 +93,29 @@ func TestServerErrorCacheSet(t *testing.T) {
 	}
 }
 
+var _ imageserver.ContextServer = &Server{}
+
+func TestServerContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "foo")
+	s := &Server{
+		Server: imageserver.ContextServerFunc(func(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+			if ctx.Value(ctxKey{}) != "foo" {
+				t.Fatal("context not forwarded")
+			}
+			return testdata.Medium, nil
+		}),
+		Cache: cachetest.NewMapCache(),
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return "test"
+		}),
+	}
+	_, err := s.GetContext(ctx, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 var _ KeyGenerator = KeyGeneratorFunc(nil)
 
 func TestNewParamsHashKeyGenerator(t *testing.T) {
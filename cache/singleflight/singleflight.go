@@ -0,0 +1,123 @@
+// Package singleflight provides a imageserver.Server implementation that groups identical concurrent calls.
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+)
+
+// Server is a imageserver.Server implementation that groups identical concurrent calls.
+//
+// Calls are grouped by the key returned by KeyGenerator.
+// The first call for a key calls the underlying Server, and the following calls for the same key wait for its result.
+// Once the result is available, the key is forgotten: an error is only returned to the callers that were waiting for it.
+//
+// The underlying Server is called with a context that is independent from the callers' context.
+// It is canceled when all callers have stopped waiting.
+// Values from the callers' context are not forwarded.
+//
+// It is typically used to wrap a cache.Server, so a cache miss on a popular Image calls the underlying Server only once.
+type Server struct {
+	imageserver.Server
+	KeyGenerator imageserver_cache.KeyGenerator
+
+	// Timeout is an optional timeout for each call.
+	// When it expires, the caller stops waiting, but the grouped call continues for the other callers.
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done    chan struct{}
+	im      *imageserver.Image
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Get implements imageserver.Server.
+func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (srv *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	if srv.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.Timeout)
+		defer cancel()
+	}
+	key := srv.KeyGenerator.GetKey(params)
+	c := srv.join(key, params)
+	select {
+	case <-c.done:
+		return c.im, c.err
+	case <-ctx.Done():
+		srv.leave(key, c)
+		return nil, ctx.Err()
+	}
+}
+
+func (srv *Server) join(key string, params imageserver.Params) *call {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.calls == nil {
+		srv.calls = make(map[string]*call)
+	}
+	c, ok := srv.calls[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		c = &call{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		srv.calls[key] = c
+		go srv.do(ctx, key, c, params)
+	}
+	c.waiters++
+	return c
+}
+
+func (srv *Server) leave(key string, c *call) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	// Nobody is waiting anymore, the call is abandoned.
+	c.cancel()
+	srv.forget(key, c)
+}
+
+// do calls the underlying Server.
+//
+// A panic is recovered and returned as an error to the waiting callers, because it happens in a goroutine that is not owned by them.
+func (srv *Server) do(ctx context.Context, key string, c *call, params imageserver.Params) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.im = nil
+			c.err = fmt.Errorf("singleflight: panic: %v", r)
+		}
+		srv.mu.Lock()
+		srv.forget(key, c)
+		srv.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
+	c.im, c.err = imageserver.GetWithContext(ctx, srv.Server, params)
+}
+
+// forget must be called with the lock held.
+func (srv *Server) forget(key string, c *call) {
+	if srv.calls[key] == c {
+		delete(srv.calls, key)
+	}
+}
@@ -0,0 +1,214 @@
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver.Server = &Server{}
+var _ imageserver.ContextServer = &Server{}
+
+var testKeyGenerator = imageserver_cache.KeyGeneratorFunc(func(params imageserver.Params) string {
+	return params.String()
+})
+
+func TestServer(t *testing.T) {
+	var count int32
+	block := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			atomic.AddInt32(&count, 1)
+			<-block
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	params := imageserver.Params{imageserver.SourceParam: testdata.MediumFileName}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			im, err := srv.Get(params)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if im != testdata.Medium {
+				t.Error("unexpected image")
+			}
+		}()
+	}
+	waitWaiters(t, srv, params, 10)
+	close(block)
+	wg.Wait()
+	if count != 1 {
+		t.Fatalf("unexpected call count: got %d, want %d", count, 1)
+	}
+}
+
+func TestServerDifferentKeys(t *testing.T) {
+	var count int32
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			atomic.AddInt32(&count, 1)
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	for _, source := range []string{"a", "b"} {
+		_, err := srv.Get(imageserver.Params{imageserver.SourceParam: source})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count != 2 {
+		t.Fatalf("unexpected call count: got %d, want %d", count, 2)
+	}
+}
+
+func TestServerErrorNotShared(t *testing.T) {
+	fail := true
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			if fail {
+				return nil, fmt.Errorf("error")
+			}
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	_, err := srv.Get(imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	fail = false
+	_, err = srv.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerPanic(t *testing.T) {
+	var count int32
+	block := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				<-block
+				panic("foo")
+			}
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	params := imageserver.Params{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := srv.Get(params)
+			if err == nil {
+				t.Error("no error")
+			}
+		}()
+	}
+	waitWaiters(t, srv, params, 3)
+	close(block)
+	wg.Wait()
+	_, err := srv.Get(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	block := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			<-block
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+		Timeout:      10 * time.Millisecond,
+	}
+	defer close(block)
+	_, err := srv.Get(imageserver.Params{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestServerCallerCanceled(t *testing.T) {
+	block := make(chan struct{})
+	srv := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			<-block
+			return testdata.Medium, nil
+		}),
+		KeyGenerator: testKeyGenerator,
+	}
+	params := imageserver.Params{}
+	done := make(chan error)
+	go func() {
+		_, err := srv.Get(params)
+		done <- err
+	}()
+	waitWaiters(t, srv, params, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := srv.GetContext(ctx, params)
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(block)
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerAllCallersCanceled(t *testing.T) {
+	srv := &Server{
+		Server: imageserver.ContextServerFunc(func(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+		KeyGenerator: testKeyGenerator,
+		Timeout:      10 * time.Millisecond,
+	}
+	_, err := srv.Get(imageserver.Params{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv.mu.Lock()
+	n := len(srv.calls)
+	srv.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("unexpected call count: got %d, want %d", n, 0)
+	}
+}
+
+func waitWaiters(t *testing.T, srv *Server, params imageserver.Params, waiters int) {
+	key := srv.KeyGenerator.GetKey(params)
+	for i := 0; i < 1000; i++ {
+		srv.mu.Lock()
+		c, ok := srv.calls[key]
+		ok = ok && c.waiters == waiters
+		srv.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	t.Fatal("timeout while waiting for waiters")
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/pierrre/imageserver"
+)
+
+// TagFunc returns the tags of a cache entry.
+//
+// A tag groups several cache entries (e.g. all the variants of a source), so they can be deleted together.
+type TagFunc func(params imageserver.Params) []string
+
+// SourceTagFunc is a TagFunc that returns the "source" param.
+func SourceTagFunc(params imageserver.Params) []string {
+	source, err := params.GetString(imageserver.SourceParam)
+	if err != nil {
+		return nil
+	}
+	return []string{source}
+}
+
+// GetTags returns the tags of all TagFunc, without duplicates.
+func GetTags(tagFuncs []TagFunc, params imageserver.Params) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, f := range tagFuncs {
+		for _, tag := range f(params) {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// TagIndex represents an index of the cache keys by tag.
+type TagIndex interface {
+	// AddTags associates the key to the tags.
+	AddTags(key string, tags []string) error
+
+	// GetKeys returns the keys associated to the tag.
+	GetKeys(tag string) ([]string, error)
+
+	// RemoveKeys dissociates the keys from the tag (not the other keys of the tag).
+	RemoveKeys(tag string, keys []string) error
+}
+
+// DeleteTag deletes all the keys associated to the tag from the Cache, and removes them from the TagIndex.
+//
+// Only the deleted keys are removed from the TagIndex, so a key that is added concurrently can still be deleted later.
+// If a key can not be deleted, the keys that are already deleted are removed, and the error is returned.
+//
+// The Cache must implement Deleter.
+func DeleteTag(c Cache, idx TagIndex, tag string) error {
+	keys, err := idx.GetKeys(tag)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		err = Delete(c, key)
+		if err != nil {
+			if i > 0 {
+				idx.RemoveKeys(tag, keys[:i])
+			}
+			return err
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return idx.RemoveKeys(tag, keys)
+}
+
+// MemoryTagIndex is an in-memory TagIndex implementation.
+//
+// The keys are not removed when the Cache evicts them, so it should be used with a bounded number of Images.
+type MemoryTagIndex struct {
+	mu   sync.RWMutex
+	tags map[string]map[string]struct{}
+}
+
+// NewMemoryTagIndex creates a new MemoryTagIndex.
+func NewMemoryTagIndex() *MemoryTagIndex {
+	return &MemoryTagIndex{
+		tags: make(map[string]map[string]struct{}),
+	}
+}
+
+// AddTags implements TagIndex.
+func (idx *MemoryTagIndex) AddTags(key string, tags []string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, tag := range tags {
+		keys, ok := idx.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			idx.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// GetKeys implements TagIndex.
+func (idx *MemoryTagIndex) GetKeys(tag string) ([]string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	keys := make([]string, 0, len(idx.tags[tag]))
+	for key := range idx.tags[tag] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// RemoveKeys implements TagIndex.
+//
+// The tag is removed when it has no keys.
+func (idx *MemoryTagIndex) RemoveKeys(tag string, keys []string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	tagKeys, ok := idx.tags[tag]
+	if !ok {
+		return nil
+	}
+	for _, key := range keys {
+		delete(tagKeys, key)
+	}
+	if len(tagKeys) == 0 {
+		delete(idx.tags, tag)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package cache_test
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	. "github.com/pierrre/imageserver/cache"
+	cachetest "github.com/pierrre/imageserver/cache/_test"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ TagIndex = &MemoryTagIndex{}
+
+func TestSourceTagFunc(t *testing.T) {
+	tags := SourceTagFunc(imageserver.Params{imageserver.SourceParam: "foo"})
+	if !reflect.DeepEqual(tags, []string{"foo"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+	tags = SourceTagFunc(imageserver.Params{})
+	if len(tags) != 0 {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+}
+
+func TestGetTags(t *testing.T) {
+	tags := GetTags([]TagFunc{
+		SourceTagFunc,
+		func(params imageserver.Params) []string {
+			return []string{"bar", "foo"}
+		},
+	}, imageserver.Params{imageserver.SourceParam: "foo"})
+	if !reflect.DeepEqual(tags, []string{"foo", "bar"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+}
+
+func TestMemoryTagIndex(t *testing.T) {
+	idx := NewMemoryTagIndex()
+	idx.AddTags("k1", []string{"a", "b"})
+	idx.AddTags("k2", []string{"a"})
+	keys, err := idx.GetKeys("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"k1", "k2"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	err = idx.RemoveKeys("a", []string{"k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ = idx.GetKeys("a")
+	if !reflect.DeepEqual(keys, []string{"k2"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	err = idx.RemoveKeys("a", []string{"k2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ = idx.GetKeys("a")
+	if len(keys) != 0 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	keys, _ = idx.GetKeys("b")
+	if len(keys) != 1 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestServerDeleteTag(t *testing.T) {
+	calls := 0
+	c := cachetest.NewMapCache()
+	s := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			calls++
+			return testdata.Medium, nil
+		}),
+		Cache: c,
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return params.String()
+		}),
+		TagIndex: NewMemoryTagIndex(),
+	}
+	paramsList := []imageserver.Params{
+		{imageserver.SourceParam: "foo", "width": 100},
+		{imageserver.SourceParam: "foo", "width": 200},
+		{imageserver.SourceParam: "bar", "width": 100},
+	}
+	get := func() {
+		for _, params := range paramsList {
+			_, err := s.Get(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	get()
+	get()
+	if calls != 3 {
+		t.Fatalf("unexpected calls: %d", calls)
+	}
+	err := s.DeleteTag("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	get()
+	if calls != 5 {
+		t.Fatalf("unexpected calls: %d", calls)
+	}
+}
+
+func TestDeleteTagConcurrentAdd(t *testing.T) {
+	idx := NewMemoryTagIndex()
+	idx.AddTags("k1", []string{"a"})
+	c := &Func{
+		DeleteFunc: func(key string) error {
+			// A key is added while the tag is deleted.
+			idx.AddTags("k2", []string{"a"})
+			return nil
+		},
+	}
+	err := DeleteTag(c, idx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := idx.GetKeys("a")
+	if !reflect.DeepEqual(keys, []string{"k2"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+type testErrorTagIndex struct {
+	TagIndex
+}
+
+func (idx *testErrorTagIndex) AddTags(key string, tags []string) error {
+	return errors.New("error")
+}
+
+func TestServerTagIndexError(t *testing.T) {
+	var errFuncErr error
+	s := &Server{
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			return testdata.Medium, nil
+		}),
+		Cache: cachetest.NewMapCache(),
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return "test"
+		}),
+		TagIndex: &testErrorTagIndex{TagIndex: NewMemoryTagIndex()},
+		ErrorFunc: func(err error, params imageserver.Params) {
+			errFuncErr = err
+		},
+	}
+	im, err := s.Get(imageserver.Params{imageserver.SourceParam: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im == nil {
+		t.Fatal("image nil")
+	}
+	if errFuncErr == nil {
+		t.Fatal("ErrorFunc not called")
+	}
+}
+
+func TestServerDeleteTagNoIndex(t *testing.T) {
+	s := &Server{Cache: cachetest.NewMapCache()}
+	err := s.DeleteTag("foo")
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
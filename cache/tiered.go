@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/pierrre/imageserver"
+)
+
+// WritePolicy is the write policy of a Tier.
+type WritePolicy int
+
+// Write policies.
+const (
+	// WriteThrough sets the Image synchronously.
+	WriteThrough WritePolicy = iota
+	// WriteAsync sets the Image from a new goroutine (like Async), and ignores the error.
+	WriteAsync
+)
+
+// ErrorPolicy is the error policy of a Tier.
+type ErrorPolicy int
+
+// Error policies.
+const (
+	// ErrorReturn returns the error.
+	ErrorReturn ErrorPolicy = iota
+	// ErrorIgnore ignores the error (like IgnoreError), a Get error is considered as a miss.
+	// Delete errors are not ignored.
+	ErrorIgnore
+)
+
+// Tier is a level of a Tiered Cache.
+type Tier struct {
+	Cache       Cache
+	WritePolicy WritePolicy
+	ErrorPolicy ErrorPolicy
+}
+
+// Tiered is a Cache implementation that composes ordered tiers (the fastest first, e.g. memory then Redis).
+//
+// Get tries the tiers in order.
+// If an Image is found in a tier, it is promoted (set) to the previous tiers.
+// A promotion error is ignored (whatever the ErrorPolicy), the found Image is returned.
+//
+// Set sets the Image to all tiers.
+//
+// Delete deletes the Image from all tiers.
+type Tiered []*Tier
+
+// Get implements Cache.
+func (c Tiered) Get(key string, params imageserver.Params) (*imageserver.Image, error) {
+	return c.GetContext(context.Background(), key, params)
+}
+
+// Set implements Cache.
+func (c Tiered) Set(key string, im *imageserver.Image, params imageserver.Params) error {
+	return c.SetContext(context.Background(), key, im, params)
+}
+
+// GetContext implements ContextCache.
+func (c Tiered) GetContext(ctx context.Context, key string, params imageserver.Params) (*imageserver.Image, error) {
+	for i, tier := range c {
+		im, err := GetWithContext(ctx, tier.Cache, key, params)
+		if err != nil {
+			// The context error is never ignored, because the next tiers would fail too.
+			if tier.ErrorPolicy == ErrorIgnore && err != ctx.Err() {
+				continue
+			}
+			return nil, err
+		}
+		if im == nil {
+			continue
+		}
+		for _, prev := range c[:i] {
+			prev.set(ctx, key, im, params)
+		}
+		return im, nil
+	}
+	return nil, nil
+}
+
+// SetContext implements ContextCache.
+func (c Tiered) SetContext(ctx context.Context, key string, im *imageserver.Image, params imageserver.Params) error {
+	for _, tier := range c {
+		err := tier.set(ctx, key, im, params)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete implements Deleter.
+//
+// It deletes the key from all tiers, and returns the first error (the ErrorPolicy is not applied).
+// It returns ErrDeleteNotSupported if a tier doesn't implement Deleter.
+func (c Tiered) Delete(key string) error {
+	var firstErr error
+	for _, tier := range c {
+		err := Delete(tier.Cache, key)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (tier *Tier) set(ctx context.Context, key string, im *imageserver.Image, params imageserver.Params) error {
+	if tier.WritePolicy == WriteAsync {
+		go func() {
+			tier.Cache.Set(key, im, params)
+		}()
+		return nil
+	}
+	err := SetWithContext(ctx, tier.Cache, key, im, params)
+	if err != nil && tier.ErrorPolicy != ErrorIgnore {
+		return err
+	}
+	return nil
+}
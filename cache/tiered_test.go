@@ -0,0 +1,202 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	. "github.com/pierrre/imageserver/cache"
+	cachetest "github.com/pierrre/imageserver/cache/_test"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ Cache = Tiered{}
+var _ ContextCache = Tiered{}
+var _ Deleter = Tiered{}
+
+func TestTieredGetSet(t *testing.T) {
+	c := Tiered{
+		{Cache: cachetest.NewMapCache()},
+		{Cache: cachetest.NewMapCache()},
+	}
+	cachetest.TestGetSet(t, c)
+	for _, tier := range c {
+		im, _ := tier.Cache.Get(cachetest.KeyValid, imageserver.Params{})
+		if im == nil {
+			t.Fatal("image not set")
+		}
+	}
+}
+
+func TestTieredGetMiss(t *testing.T) {
+	c := Tiered{
+		{Cache: cachetest.NewMapCache()},
+		{Cache: cachetest.NewMapCache()},
+	}
+	cachetest.TestGetMiss(t, c)
+}
+
+func TestTieredDelete(t *testing.T) {
+	c := Tiered{
+		{Cache: cachetest.NewMapCache()},
+		{Cache: cachetest.NewMapCache()},
+	}
+	cachetest.TestDelete(t, c)
+}
+
+func TestTieredDeleteNotSupported(t *testing.T) {
+	c := Tiered{
+		{Cache: cachetest.NewMapCache()},
+		{Cache: &Func{}},
+	}
+	err := c.Delete("test")
+	if err != ErrDeleteNotSupported {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c[1].ErrorPolicy = ErrorIgnore
+	err = c.Delete("test")
+	if err != ErrDeleteNotSupported {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTieredDeleteErrorAllTiers(t *testing.T) {
+	errTest := errors.New("error")
+	l2 := cachetest.NewMapCache()
+	l2.Set("test", testdata.Small, imageserver.Params{})
+	c := Tiered{
+		{Cache: &Func{DeleteFunc: func(key string) error { return errTest }}},
+		{Cache: l2},
+	}
+	err := c.Delete("test")
+	if err != errTest {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	im, _ := l2.Get("test", imageserver.Params{})
+	if im != nil {
+		t.Fatal("image not deleted")
+	}
+}
+
+func TestTieredPromotion(t *testing.T) {
+	l1, l2, l3 := cachetest.NewMapCache(), cachetest.NewMapCache(), cachetest.NewMapCache()
+	c := Tiered{{Cache: l1}, {Cache: l2}, {Cache: l3}}
+	l2.Set("test", testdata.Medium, imageserver.Params{})
+	im, err := c.Get("test", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im == nil {
+		t.Fatal("image nil")
+	}
+	if im, _ := l1.Get("test", imageserver.Params{}); im == nil {
+		t.Fatal("image not promoted")
+	}
+	if im, _ := l3.Get("test", imageserver.Params{}); im != nil {
+		t.Fatal("image set in a slower tier")
+	}
+}
+
+func TestTieredPromotionError(t *testing.T) {
+	l1, l3 := cachetest.NewMapCache(), cachetest.NewMapCache()
+	l2 := &Func{
+		GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+			return nil, nil
+		},
+		SetFunc: func(key string, im *imageserver.Image, params imageserver.Params) error {
+			return errors.New("error")
+		},
+	}
+	c := Tiered{{Cache: l1}, {Cache: l2}, {Cache: l3}}
+	l3.Set("test", testdata.Medium, imageserver.Params{})
+	im, err := c.Get("test", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != testdata.Medium {
+		t.Fatal("unexpected image")
+	}
+	// The other tiers are still promoted.
+	im, _ = l1.Get("test", imageserver.Params{})
+	if im == nil {
+		t.Fatal("image not promoted")
+	}
+}
+
+func TestTieredWriteAsync(t *testing.T) {
+	setCallCh := make(chan struct{}, 1)
+	l2 := cachetest.NewMapCache()
+	c := Tiered{
+		{Cache: cachetest.NewMapCache()},
+		{
+			Cache: &Func{
+				GetFunc: l2.Get,
+				SetFunc: func(key string, im *imageserver.Image, params imageserver.Params) error {
+					err := l2.Set(key, im, params)
+					setCallCh <- struct{}{}
+					return err
+				},
+			},
+			WritePolicy: WriteAsync,
+		},
+	}
+	err := c.Set("test", testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-setCallCh
+	if im, _ := l2.Get("test", imageserver.Params{}); im == nil {
+		t.Fatal("image not set")
+	}
+}
+
+func TestTieredError(t *testing.T) {
+	errorCache := &Func{
+		GetFunc: func(key string, params imageserver.Params) (*imageserver.Image, error) {
+			return nil, fmt.Errorf("error")
+		},
+		SetFunc: func(key string, im *imageserver.Image, params imageserver.Params) error {
+			return fmt.Errorf("error")
+		},
+	}
+	l2 := cachetest.NewMapCache()
+	l2.Set("test", testdata.Medium, imageserver.Params{})
+	c := Tiered{
+		{Cache: errorCache},
+		{Cache: l2},
+	}
+	_, err := c.Get("test", imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	err = c.Set("test", testdata.Medium, imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	c[0].ErrorPolicy = ErrorIgnore
+	im, err := c.Get("test", imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im == nil {
+		t.Fatal("image nil")
+	}
+	err = c.Set("test", testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTieredContextCanceled(t *testing.T) {
+	c := Tiered{
+		{Cache: cachetest.NewMapCache(), ErrorPolicy: ErrorIgnore},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetContext(ctx, "test", imageserver.Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pierrre/imageserver"
+)
+
+const (
+	// StoredMetadata is the Image metadata key that contains the time when the Image was stored in the Cache (RFC 3339).
+	StoredMetadata = "cache_stored"
+	// TTLMetadata is the Image metadata key that contains the TTL of the cache entry (in milliseconds).
+	TTLMetadata = "cache_ttl"
+
+	// TTLParam is the param that contains the TTL of the cache entry (a time.Duration, or an int in seconds).
+	TTLParam = "cache_ttl"
+)
+
+// GetTTLParam returns the TTL from the "cache_ttl" param.
+//
+// It returns false if the param is not set.
+func GetTTLParam(params imageserver.Params) (time.Duration, bool, error) {
+	if !params.Has(TTLParam) {
+		return 0, false, nil
+	}
+	v, _ := params.Get(TTLParam)
+	switch v := v.(type) {
+	case time.Duration:
+		return v, true, nil
+	case int:
+		return time.Duration(v) * time.Second, true, nil
+	}
+	return 0, false, &imageserver.ParamError{Param: TTLParam, Message: "must be a time.Duration or an int"}
+}
+
+// setTTLMetadata returns a copy of the Image with the stored time and the TTL in its metadata.
+func setTTLMetadata(im *imageserver.Image, stored time.Time, ttl time.Duration) *imageserver.Image {
+	res := new(imageserver.Image)
+	*res = *im
+	res.Metadata = make(map[string]string, len(im.Metadata)+2)
+	for k, v := range im.Metadata {
+		res.Metadata[k] = v
+	}
+	res.Metadata[StoredMetadata] = stored.UTC().Format(time.RFC3339Nano)
+	res.Metadata[TTLMetadata] = strconv.FormatInt(int64(getTTLMilliseconds(ttl)), 10)
+	return res
+}
+
+// getTTLMetadata returns the stored time and the TTL from the Image metadata.
+//
+// It returns false if they are missing or invalid (the entry never expires).
+func getTTLMetadata(im *imageserver.Image) (time.Time, time.Duration, bool) {
+	stored, err := time.Parse(time.RFC3339Nano, im.Metadata[StoredMetadata])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	ttl, err := strconv.ParseInt(im.Metadata[TTLMetadata], 10, 64)
+	if err != nil || ttl <= 0 {
+		return time.Time{}, 0, false
+	}
+	return stored, time.Duration(ttl) * time.Millisecond, true
+}
+
+// getTTLMilliseconds returns the TTL in milliseconds.
+//
+// It is rounded up, so a sub-millisecond TTL doesn't become 0 (no expiration).
+func getTTLMilliseconds(ttl time.Duration) time.Duration {
+	ms := ttl / time.Millisecond
+	if ttl%time.Millisecond != 0 {
+		ms++
+	}
+	return ms
+}
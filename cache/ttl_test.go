@@ -0,0 +1,243 @@
+package cache_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	. "github.com/pierrre/imageserver/cache"
+	cachetest "github.com/pierrre/imageserver/cache/_test"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestGetTTLParam(t *testing.T) {
+	for _, tc := range []struct {
+		params        imageserver.Params
+		expectedTTL   time.Duration
+		expectedOK    bool
+		expectedError bool
+	}{
+		{imageserver.Params{}, 0, false, false},
+		{imageserver.Params{TTLParam: 60}, time.Minute, true, false},
+		{imageserver.Params{TTLParam: time.Hour}, time.Hour, true, false},
+		{imageserver.Params{TTLParam: "invalid"}, 0, false, true},
+	} {
+		ttl, ok, err := GetTTLParam(tc.params)
+		if (err != nil) != tc.expectedError {
+			t.Fatalf("unexpected error for %s: %v", tc.params, err)
+		}
+		if ttl != tc.expectedTTL || ok != tc.expectedOK {
+			t.Fatalf("unexpected result for %s: %s %t", tc.params, ttl, ok)
+		}
+	}
+}
+
+type testTTLServer struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+	ch    chan struct{}
+}
+
+func (srv *testTTLServer) Get(params imageserver.Params) (*imageserver.Image, error) {
+	srv.mu.Lock()
+	srv.calls++
+	err := srv.err
+	srv.mu.Unlock()
+	if srv.ch != nil {
+		defer func() {
+			srv.ch <- struct{}{}
+		}()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return testdata.Medium, nil
+}
+
+func (srv *testTTLServer) getCalls() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.calls
+}
+
+func newTestTTLServer(srv imageserver.Server, now *time.Time) *Server {
+	return &Server{
+		Server: srv,
+		Cache:  cachetest.NewMapCache(),
+		KeyGenerator: KeyGeneratorFunc(func(params imageserver.Params) string {
+			return "test"
+		}),
+		TTLFunc: func(params imageserver.Params) time.Duration {
+			return time.Minute
+		},
+		StaleWhileRevalidate: time.Minute,
+		StaleIfError:         time.Hour,
+		Now: func() time.Time {
+			return *now
+		},
+	}
+}
+
+func TestServerTTL(t *testing.T) {
+	now := time.Now()
+	srv := &testTTLServer{}
+	s := newTestTTLServer(srv, &now)
+	s.StaleWhileRevalidate = 0
+	im, err := s.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Metadata[TTLMetadata] != "60000" || im.Metadata[StoredMetadata] == "" {
+		t.Fatalf("unexpected metadata: %v", im.Metadata)
+	}
+	now = now.Add(30 * time.Second)
+	s.Get(imageserver.Params{})
+	if srv.getCalls() != 1 {
+		t.Fatalf("unexpected calls: %d", srv.getCalls())
+	}
+	now = now.Add(time.Minute)
+	s.Get(imageserver.Params{})
+	if srv.getCalls() != 2 {
+		t.Fatalf("unexpected calls: %d", srv.getCalls())
+	}
+}
+
+func TestServerTTLSubSecond(t *testing.T) {
+	for _, tc := range []struct {
+		ttl              time.Duration
+		expectedMetadata string
+	}{
+		{500 * time.Millisecond, "500"},
+		{time.Nanosecond, "1"},
+		{1500 * time.Microsecond, "2"},
+	} {
+		func() {
+			defer func() {
+				if t.Failed() {
+					t.Logf("%s", tc.ttl)
+				}
+			}()
+			now := time.Now()
+			srv := &testTTLServer{}
+			s := newTestTTLServer(srv, &now)
+			s.TTLFunc = func(params imageserver.Params) time.Duration {
+				return tc.ttl
+			}
+			s.StaleWhileRevalidate = 0
+			s.StaleIfError = 0
+			im, err := s.Get(imageserver.Params{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if im.Metadata[TTLMetadata] != tc.expectedMetadata {
+				t.Fatalf("unexpected metadata: %v", im.Metadata)
+			}
+			now = now.Add(time.Hour)
+			s.Get(imageserver.Params{})
+			if srv.getCalls() != 2 {
+				t.Fatalf("unexpected calls: %d", srv.getCalls())
+			}
+		}()
+	}
+}
+
+func TestServerTTLParam(t *testing.T) {
+	now := time.Now()
+	srv := &testTTLServer{}
+	s := newTestTTLServer(srv, &now)
+	s.StaleWhileRevalidate = 0
+	params := imageserver.Params{TTLParam: 3600}
+	s.Get(params)
+	now = now.Add(30 * time.Minute)
+	s.Get(params)
+	if srv.getCalls() != 1 {
+		t.Fatalf("unexpected calls: %d", srv.getCalls())
+	}
+	_, err := s.Get(imageserver.Params{TTLParam: "invalid"})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func TestServerNoTTL(t *testing.T) {
+	now := time.Now()
+	srv := &testTTLServer{}
+	s := newTestTTLServer(srv, &now)
+	s.TTLFunc = nil
+	im, err := s.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Metadata[TTLMetadata] != "" {
+		t.Fatalf("unexpected metadata: %v", im.Metadata)
+	}
+	now = now.Add(24 * time.Hour)
+	s.Get(imageserver.Params{})
+	if srv.getCalls() != 1 {
+		t.Fatalf("unexpected calls: %d", srv.getCalls())
+	}
+}
+
+func TestServerStaleWhileRevalidate(t *testing.T) {
+	now := time.Now()
+	srv := &testTTLServer{}
+	s := newTestTTLServer(srv, &now)
+	s.Get(imageserver.Params{})
+	now = now.Add(90 * time.Second)
+	srv.ch = make(chan struct{})
+	for i := 0; i < 3; i++ {
+		im, err := s.Get(imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if im == nil {
+			t.Fatal("image nil")
+		}
+	}
+	<-srv.ch
+	srv.ch = nil
+	// Only one background refresh for the key.
+	if srv.getCalls() != 2 {
+		t.Fatalf("unexpected calls: %d", srv.getCalls())
+	}
+	// Wait for the end of the background refresh.
+	for i := 0; ; i++ {
+		im, _ := s.Cache.Get("test", imageserver.Params{})
+		stored, _ := time.Parse(time.RFC3339Nano, im.Metadata[StoredMetadata])
+		if stored.Equal(now) {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("the Image is not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Get(imageserver.Params{})
+	if srv.getCalls() != 2 {
+		t.Fatalf("unexpected calls: %d", srv.getCalls())
+	}
+}
+
+func TestServerStaleIfError(t *testing.T) {
+	now := time.Now()
+	srv := &testTTLServer{}
+	s := newTestTTLServer(srv, &now)
+	s.Get(imageserver.Params{})
+	srv.err = fmt.Errorf("error")
+	now = now.Add(30 * time.Minute)
+	im, err := s.Get(imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im == nil {
+		t.Fatal("image nil")
+	}
+	now = now.Add(2 * time.Hour)
+	_, err = s.Get(imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
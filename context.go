@@ -0,0 +1,116 @@
+package imageserver
+
+import (
+	"context"
+)
+
+// ContextServer is a Server that supports a context.Context.
+//
+// The context carries the cancellation and deadline of the request.
+// Implementations should stop their work and return the context error as soon as the context is done.
+type ContextServer interface {
+	GetContext(context.Context, Params) (*Image, error)
+}
+
+// ContextServerFunc is a ContextServer func.
+//
+// It also implements Server, with context.Background().
+type ContextServerFunc func(ctx context.Context, params Params) (*Image, error)
+
+// GetContext implements ContextServer.
+func (f ContextServerFunc) GetContext(ctx context.Context, params Params) (*Image, error) {
+	return f(ctx, params)
+}
+
+// Get implements Server.
+func (f ContextServerFunc) Get(params Params) (*Image, error) {
+	return f(context.Background(), params)
+}
+
+// GetWithContext calls the Server with a context.Context.
+//
+// If the Server implements ContextServer, GetContext() is called.
+// Otherwise, the context is checked before calling Get().
+func GetWithContext(ctx context.Context, srv Server, params Params) (*Image, error) {
+	if csrv, ok := srv.(ContextServer); ok {
+		return csrv.GetContext(ctx, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return srv.Get(params)
+}
+
+// NewContextServer returns a ContextServer for the given Server.
+//
+// If the Server already implements ContextServer, it is returned as is.
+// Otherwise, the context is only checked before calling the Server.
+func NewContextServer(srv Server) ContextServer {
+	if csrv, ok := srv.(ContextServer); ok {
+		return csrv
+	}
+	return ContextServerFunc(func(ctx context.Context, params Params) (*Image, error) {
+		return GetWithContext(ctx, srv, params)
+	})
+}
+
+// NewServerFromContext returns a Server for the given ContextServer.
+//
+// Calls to Get() use context.Background().
+func NewServerFromContext(csrv ContextServer) Server {
+	return ContextServerFunc(csrv.GetContext)
+}
+
+// ContextHandler is a Handler that supports a context.Context.
+type ContextHandler interface {
+	HandleContext(context.Context, *Image, Params) (*Image, error)
+}
+
+// ContextHandlerFunc is a ContextHandler func.
+//
+// It also implements Handler, with context.Background().
+type ContextHandlerFunc func(ctx context.Context, im *Image, params Params) (*Image, error)
+
+// HandleContext implements ContextHandler.
+func (f ContextHandlerFunc) HandleContext(ctx context.Context, im *Image, params Params) (*Image, error) {
+	return f(ctx, im, params)
+}
+
+// Handle implements Handler.
+func (f ContextHandlerFunc) Handle(im *Image, params Params) (*Image, error) {
+	return f(context.Background(), im, params)
+}
+
+// HandleWithContext calls the Handler with a context.Context.
+//
+// If the Handler implements ContextHandler, HandleContext() is called.
+// Otherwise, the context is checked before calling Handle().
+func HandleWithContext(ctx context.Context, hdr Handler, im *Image, params Params) (*Image, error) {
+	if chdr, ok := hdr.(ContextHandler); ok {
+		return chdr.HandleContext(ctx, im, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return hdr.Handle(im, params)
+}
+
+// NewContextHandler returns a ContextHandler for the given Handler.
+//
+// If the Handler already implements ContextHandler, it is returned as is.
+// Otherwise, the context is only checked before calling the Handler.
+func NewContextHandler(hdr Handler) ContextHandler {
+	if chdr, ok := hdr.(ContextHandler); ok {
+		return chdr
+	}
+	return ContextHandlerFunc(func(ctx context.Context, im *Image, params Params) (*Image, error) {
+		return HandleWithContext(ctx, hdr, im, params)
+	})
+}
+
+// NewHandlerFromContext returns a Handler for the given ContextHandler.
+//
+// Calls to Handle() use context.Background().
+func NewHandlerFromContext(chdr ContextHandler) Handler {
+	return ContextHandlerFunc(chdr.HandleContext)
+}
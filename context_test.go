@@ -0,0 +1,134 @@
+package imageserver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var _ Server = ContextServerFunc(nil)
+var _ ContextServer = ContextServerFunc(nil)
+
+func TestGetWithContextServer(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "foo")
+	srv := ContextServerFunc(func(ctx context.Context, params Params) (*Image, error) {
+		if ctx.Value(ctxKey{}) != "foo" {
+			t.Fatal("context not forwarded")
+		}
+		return &Image{}, nil
+	})
+	_, err := GetWithContext(ctx, srv, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv := ServerFunc(func(params Params) (*Image, error) {
+		t.Fatal("should not be called")
+		return nil, nil
+	})
+	_, err := GetWithContext(ctx, srv, Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewContextServer(t *testing.T) {
+	called := false
+	csrv := NewContextServer(ServerFunc(func(params Params) (*Image, error) {
+		called = true
+		return &Image{}, nil
+	}))
+	_, err := csrv.GetContext(context.Background(), Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("not called")
+	}
+}
+
+func TestNewServerFromContext(t *testing.T) {
+	srv := NewServerFromContext(ContextServerFunc(func(ctx context.Context, params Params) (*Image, error) {
+		if ctx == nil {
+			t.Fatal("nil context")
+		}
+		return &Image{}, nil
+	}))
+	_, err := srv.Get(Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+var _ Handler = ContextHandlerFunc(nil)
+var _ ContextHandler = ContextHandlerFunc(nil)
+
+func TestHandleWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hdr := HandlerFunc(func(im *Image, params Params) (*Image, error) {
+		t.Fatal("should not be called")
+		return nil, nil
+	})
+	_, err := HandleWithContext(ctx, hdr, &Image{}, Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewContextHandler(t *testing.T) {
+	chdr := NewContextHandler(HandlerFunc(func(im *Image, params Params) (*Image, error) {
+		return im, nil
+	}))
+	_, err := chdr.HandleContext(context.Background(), &Image{}, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := NewHandlerFromContext(chdr)
+	_, err = hdr.Handle(&Image{}, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerServerContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &HandlerServer{
+		Server: ServerFunc(func(params Params) (*Image, error) {
+			cancel()
+			return &Image{}, nil
+		}),
+		Handler: HandlerFunc(func(im *Image, params Params) (*Image, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		}),
+	}
+	_, err := srv.GetContext(ctx, Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewLimitServerContextCanceled(t *testing.T) {
+	started := make(chan struct{})
+	block := make(chan struct{})
+	srv := NewLimitServer(ServerFunc(func(params Params) (*Image, error) {
+		close(started)
+		<-block
+		return &Image{}, nil
+	}), 1)
+	go srv.Get(Params{})
+	<-started
+	defer close(block)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := GetWithContext(ctx, srv, Params{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package imageserver
+
+import (
+	"context"
+	"strings"
+)
+
+// OriginMetadata is the Image metadata key that contains the name of the Origin that served the Image (see FailoverServer).
+const OriginMetadata = "origin"
+
+// Origin is an origin of a FailoverServer.
+type Origin struct {
+	// Name is the name of the Origin.
+	// It is stored in the Image metadata (see OriginMetadata).
+	Name string
+
+	// Server is the Server of the Origin.
+	Server Server
+
+	// SourceFunc is an optional func that rewrites the "source" param for this Origin (see SourcePrefix and SourceTemplate).
+	SourceFunc func(source string) string
+}
+
+// SourcePrefix returns a func that adds a prefix to the "source" param.
+//
+// It can be used as Origin.SourceFunc.
+func SourcePrefix(prefix string) func(string) string {
+	return func(source string) string {
+		return prefix + source
+	}
+}
+
+// SourceTemplate returns a func that replaces "{source}" in the template with the "source" param.
+//
+// It can be used as Origin.SourceFunc.
+// Example: "https://backup.example.com/images{source}".
+func SourceTemplate(template string) func(string) string {
+	return func(source string) string {
+		return strings.Replace(template, "{source}", source, -1)
+	}
+}
+
+// FailoverServer is a Server implementation that tries Origins in order, until one of them returns an Image.
+//
+// FailoverFunc decides which errors trigger a failover.
+// If all Origins fail, the error of the last tried Origin is returned.
+// Context errors never trigger a failover.
+//
+// The returned Image is a copy with the name of the Origin in its metadata (see OriginMetadata).
+type FailoverServer struct {
+	Origins []*Origin
+
+	// FailoverFunc is an optional func that returns true if the error should trigger a failover.
+	// FailoverDefault is used by default.
+	FailoverFunc func(error) bool
+}
+
+// Get implements Server.
+func (s *FailoverServer) Get(params Params) (*Image, error) {
+	return s.GetContext(context.Background(), params)
+}
+
+// GetContext implements ContextServer.
+func (s *FailoverServer) GetContext(ctx context.Context, params Params) (*Image, error) {
+	if len(s.Origins) == 0 {
+		return nil, &ImageError{Message: "no origin"}
+	}
+	source, err := params.GetString(SourceParam)
+	if err != nil {
+		return nil, err
+	}
+	failoverFunc := s.FailoverFunc
+	if failoverFunc == nil {
+		failoverFunc = FailoverDefault
+	}
+	for _, origin := range s.Origins {
+		var im *Image
+		im, err = GetWithContext(ctx, origin.Server, getOriginParams(origin, params, source))
+		if err == nil {
+			return newOriginImage(im, origin), nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if !failoverFunc(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func getOriginParams(origin *Origin, params Params, source string) Params {
+	if origin.SourceFunc == nil {
+		return params
+	}
+	originParams := make(Params, len(params))
+	for k, v := range params {
+		originParams[k] = v
+	}
+	originParams.Set(SourceParam, origin.SourceFunc(source))
+	return originParams
+}
+
+func newOriginImage(im *Image, origin *Origin) *Image {
+	res := *im
+	res.Metadata = make(map[string]string, len(im.Metadata)+1)
+	for k, v := range im.Metadata {
+		res.Metadata[k] = v
+	}
+	res.Metadata[OriginMetadata] = origin.Name
+	return &res
+}
+
+// FailoverNotFound returns true if the error is a *ParamError with NotFound set.
+//
+// Sources return this error when the Image doesn't exist (see NewSourceNotFoundError).
+func FailoverNotFound(err error) bool {
+	errParam, ok := err.(*ParamError)
+	return ok && errParam.NotFound
+}
+
+// FailoverTransport returns true if the origin failed for another reason than a missing Image or an invalid param.
+//
+// It includes the network errors and the unexpected responses of the origin (*ParamError for the "source" param without NotFound),
+// and the other errors that are not *ParamError.
+// It returns false for context errors.
+func FailoverTransport(err error) bool {
+	if errParam, ok := err.(*ParamError); ok {
+		return errParam.Param == SourceParam && !errParam.NotFound
+	}
+	return err != context.Canceled && err != context.DeadlineExceeded
+}
+
+// FailoverDefault returns true if FailoverNotFound or FailoverTransport return true.
+func FailoverDefault(err error) bool {
+	return FailoverNotFound(err) || FailoverTransport(err)
+}
@@ -0,0 +1,128 @@
+package imageserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+var _ Server = &FailoverServer{}
+
+var _ ContextServer = &FailoverServer{}
+
+func newTestOriginServer(im *Image, err error, calls *[]string) Server {
+	return ServerFunc(func(params Params) (*Image, error) {
+		source, _ := params.GetString(SourceParam)
+		*calls = append(*calls, source)
+		return im, err
+	})
+}
+
+func TestFailoverServer(t *testing.T) {
+	var calls []string
+	im := &Image{Format: "jpeg", Data: []byte("foo"), Metadata: map[string]string{"foo": "bar"}}
+	srv := &FailoverServer{
+		Origins: []*Origin{
+			{Name: "primary", Server: newTestOriginServer(nil, &ParamError{Param: SourceParam, Message: "not found"}, &calls)},
+			{Name: "secondary", Server: newTestOriginServer(nil, fmt.Errorf("connection refused"), &calls), SourceFunc: SourcePrefix("/backup")},
+			{Name: "tertiary", Server: newTestOriginServer(im, nil, &calls), SourceFunc: SourceTemplate("http://example.com{source}?v=1")},
+		},
+	}
+	res, err := srv.Get(Params{SourceParam: "/foo.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCalls := []string{"/foo.jpg", "/backup/foo.jpg", "http://example.com/foo.jpg?v=1"}
+	if fmt.Sprint(calls) != fmt.Sprint(expectedCalls) {
+		t.Fatalf("unexpected calls: got %v, want %v", calls, expectedCalls)
+	}
+	if !ImageEqual(res, im) {
+		t.Fatal("not equal")
+	}
+	if origin := res.Metadata[OriginMetadata]; origin != "tertiary" {
+		t.Fatalf("unexpected origin: got \"%s\", want \"%s\"", origin, "tertiary")
+	}
+	if res.Metadata["foo"] != "bar" {
+		t.Fatal("metadata not copied")
+	}
+	if _, ok := im.Metadata[OriginMetadata]; ok {
+		t.Fatal("the original Image was modified")
+	}
+}
+
+func TestFailoverServerFailoverFunc(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		failoverFunc  func(error) bool
+		err           error
+		expectedCalls int
+	}{
+		{"NotFoundWithNotFound", FailoverNotFound, NewSourceNotFoundError("not found"), 2},
+		{"NotFoundWithTransport", FailoverNotFound, fmt.Errorf("error"), 1},
+		{"NotFoundWithSourceError", FailoverNotFound, &ParamError{Param: SourceParam, Message: "status 503"}, 1},
+		{"TransportWithNotFound", FailoverTransport, NewSourceNotFoundError("not found"), 1},
+		{"TransportWithTransport", FailoverTransport, fmt.Errorf("error"), 2},
+		{"TransportWithSourceError", FailoverTransport, &ParamError{Param: SourceParam, Message: "status 503"}, 2},
+		{"DefaultWithOtherParam", nil, &ParamError{Param: "width", Message: "invalid"}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			srv := &FailoverServer{
+				Origins: []*Origin{
+					{Name: "primary", Server: newTestOriginServer(nil, tc.err, &calls)},
+					{Name: "secondary", Server: newTestOriginServer(nil, tc.err, &calls)},
+				},
+				FailoverFunc: tc.failoverFunc,
+			}
+			_, err := srv.Get(Params{SourceParam: "foo"})
+			if err != tc.err {
+				t.Fatalf("unexpected error: got %v, want %v", err, tc.err)
+			}
+			if len(calls) != tc.expectedCalls {
+				t.Fatalf("unexpected calls count: got %d, want %d", len(calls), tc.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestFailoverServerContextCanceled(t *testing.T) {
+	var calls []string
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &FailoverServer{
+		Origins: []*Origin{
+			{Name: "primary", Server: ServerFunc(func(params Params) (*Image, error) {
+				calls = append(calls, "primary")
+				cancel()
+				return nil, fmt.Errorf("error")
+			})},
+			{Name: "secondary", Server: newTestOriginServer(&Image{}, nil, &calls)},
+		},
+	}
+	_, err := srv.GetContext(ctx, Params{SourceParam: "foo"})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: got %v, want %v", err, context.Canceled)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("unexpected calls count: got %d, want 1", len(calls))
+	}
+}
+
+func TestFailoverServerErrorNoSource(t *testing.T) {
+	srv := &FailoverServer{
+		Origins: []*Origin{{Name: "primary", Server: ServerFunc(func(params Params) (*Image, error) {
+			return &Image{}, nil
+		})}},
+	}
+	_, err := srv.Get(Params{})
+	if _, ok := err.(*ParamError); !ok {
+		t.Fatalf("unexpected error type: %T", err)
+	}
+}
+
+func TestFailoverServerErrorNoOrigin(t *testing.T) {
+	srv := &FailoverServer{}
+	_, err := srv.Get(Params{SourceParam: "foo"})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
@@ -0,0 +1,185 @@
+// Package filesource provides a imageserver.Server implementation that gets the Image from a file.
+package filesource
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/internal/sniff"
+)
+
+// Server is a imageserver.Server implementation that gets the Image from a file.
+//
+// The "source" param is a slash-separated path, relative to Root.
+// It returns a *imageserver.ParamError if the path contains "..", or if it resolves (through symlinks) outside of Root.
+//
+// The path is resolved before the file is opened, so a path component could be replaced by a symlink in the meantime.
+// After opening, the file is compared (os.SameFile) with a new resolution of the path, and it is rejected if they differ.
+// The remaining risks are: a file outside of Root can be opened (but not read), which matters for special files (e.g. FIFO),
+// and a hard link inside Root to a file outside of Root can not be detected.
+// Root should not be writable by untrusted users.
+//
+// The Image format is detected from the file content (magic bytes), not from the file extension.
+// Files with an unknown format are rejected.
+type Server struct {
+	// Root is the root directory.
+	Root string
+
+	// MaxSize is an optional maximum file size (in bytes).
+	MaxSize int64
+}
+
+// Get implements imageserver.Server.
+func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	filePath, err := srv.getFilePath(params)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, newSourceError(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, newSourceError(err)
+	}
+	err = checkSameFile(filePath, fi)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, &imageserver.ParamError{Param: imageserver.SourceParam, Message: "is a directory"}
+	}
+	err = srv.checkSize(fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	if srv.MaxSize > 0 {
+		// The file could grow after Stat().
+		r = io.LimitReader(r, srv.MaxSize+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	err = srv.checkSize(int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	format := sniff.Format(data)
+	if format == "" {
+		return nil, &imageserver.ImageError{Message: "unknown image format"}
+	}
+	return &imageserver.Image{
+		Format: format,
+		Data:   data,
+	}, nil
+}
+
+// ModTime returns the modification time of the file.
+//
+// It can be used to build the ETag or Last-Modified values.
+func (srv *Server) ModTime(params imageserver.Params) (time.Time, error) {
+	filePath, err := srv.getFilePath(params)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}, newSourceError(err)
+	}
+	err = checkSameFile(filePath, fi)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+func (srv *Server) getFilePath(params imageserver.Params) (string, error) {
+	source, err := params.GetString(imageserver.SourceParam)
+	if err != nil {
+		return "", err
+	}
+	for _, s := range strings.Split(filepath.ToSlash(source), "/") {
+		if s == ".." {
+			return "", &imageserver.ParamError{Param: imageserver.SourceParam, Message: "must not contain \"..\""}
+		}
+	}
+	root, err := filepath.EvalSymlinks(srv.Root)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(root, filepath.FromSlash(path.Clean("/"+source)))
+	filePath, err = filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return "", newSourceError(err)
+	}
+	if !isInDir(filePath, root) {
+		return "", &imageserver.ParamError{Param: imageserver.SourceParam, Message: "is outside of the root directory"}
+	}
+	return filePath, nil
+}
+
+// checkSameFile checks that the resolved path still refers to the file, and doesn't contain symlinks.
+//
+// It detects a path component that has been replaced by a symlink after the path was resolved.
+func checkSameFile(filePath string, fi os.FileInfo) error {
+	resolved, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return newSourceError(err)
+	}
+	if resolved != filePath {
+		return errFileChanged
+	}
+	lfi, err := os.Lstat(filePath)
+	if err != nil {
+		return newSourceError(err)
+	}
+	if !os.SameFile(fi, lfi) {
+		return errFileChanged
+	}
+	return nil
+}
+
+var errFileChanged = &imageserver.ParamError{Param: imageserver.SourceParam, Message: "file changed during the resolution"}
+
+func isInDir(p string, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (srv *Server) checkSize(size int64) error {
+	if srv.MaxSize > 0 && size > srv.MaxSize {
+		return &imageserver.ParamError{
+			Param:   imageserver.SourceParam,
+			Message: fmt.Sprintf("file size is greater than the maximum value %d", srv.MaxSize),
+		}
+	}
+	return nil
+}
+
+func newSourceError(err error) error {
+	if os.IsNotExist(err) {
+		return imageserver.NewSourceNotFoundError("file not found")
+	}
+	if os.IsPermission(err) {
+		return &imageserver.ParamError{Param: imageserver.SourceParam, Message: "permission denied"}
+	}
+	return err
+}
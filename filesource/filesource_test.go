@@ -0,0 +1,184 @@
+package filesource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver.Server = &Server{}
+
+func TestGet(t *testing.T) {
+	srv := &Server{Root: testdata.Dir}
+	for _, tc := range []struct {
+		source   string
+		expected *imageserver.Image
+	}{
+		{testdata.MediumFileName, testdata.Medium},
+		{"/" + testdata.MediumFileName, testdata.Medium},
+		{"./" + testdata.AnimatedFileName, testdata.Animated},
+		{testdata.RandomFileName, testdata.Random},
+	} {
+		im, err := srv.Get(imageserver.Params{imageserver.SourceParam: tc.source})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !imageserver.ImageEqual(im, tc.expected) {
+			t.Fatalf("unexpected image for source \"%s\"", tc.source)
+		}
+	}
+}
+
+func TestGetFormatFromContent(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	writeTestFile(t, filepath.Join(dir, "image.png"), testdata.Medium.Data)
+	srv := &Server{Root: dir}
+	im, err := srv.Get(imageserver.Params{imageserver.SourceParam: "image.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Format != "jpeg" {
+		t.Fatalf("unexpected format: got \"%s\", want \"%s\"", im.Format, "jpeg")
+	}
+}
+
+func TestGetErrorParam(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	writeTestFile(t, filepath.Join(dir, "root", "image.jpg"), testdata.Medium.Data)
+	writeTestFile(t, filepath.Join(dir, "secret.jpg"), testdata.Medium.Data)
+	err := os.Symlink(filepath.Join(dir, "secret.jpg"), filepath.Join(dir, "root", "link.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(dir, filepath.Join(dir, "root", "parent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		Root:    filepath.Join(dir, "root"),
+		MaxSize: int64(len(testdata.Medium.Data)),
+	}
+	for _, params := range []imageserver.Params{
+		{},
+		{imageserver.SourceParam: 1},
+		{imageserver.SourceParam: "../secret.jpg"},
+		{imageserver.SourceParam: "foo/../../secret.jpg"},
+		{imageserver.SourceParam: "link.jpg"},
+		{imageserver.SourceParam: "parent/secret.jpg"},
+		{imageserver.SourceParam: "unknown.jpg"},
+		{imageserver.SourceParam: "/"},
+	} {
+		_, err := srv.Get(params)
+		if _, ok := err.(*imageserver.ParamError); !ok {
+			t.Fatalf("unexpected error for %s: %v", params, err)
+		}
+	}
+}
+
+func TestGetErrorMaxSize(t *testing.T) {
+	srv := &Server{
+		Root:    testdata.Dir,
+		MaxSize: 100,
+	}
+	_, err := srv.Get(imageserver.Params{imageserver.SourceParam: testdata.MediumFileName})
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGetErrorUnknownFormat(t *testing.T) {
+	srv := &Server{Root: testdata.Dir}
+	_, err := srv.Get(imageserver.Params{imageserver.SourceParam: "testdata.go"})
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestModTime(t *testing.T) {
+	srv := &Server{Root: testdata.Dir}
+	params := imageserver.Params{imageserver.SourceParam: testdata.MediumFileName}
+	modTime, err := srv.ModTime(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(testdata.Dir, testdata.MediumFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !modTime.Equal(fi.ModTime()) {
+		t.Fatalf("unexpected mod time: got %s, want %s", modTime, fi.ModTime())
+	}
+	_, err = srv.ModTime(imageserver.Params{imageserver.SourceParam: "unknown.jpg"})
+	if errParam, ok := err.(*imageserver.ParamError); !ok || !errParam.NotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "imageserver_filesource_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) {
+	err := os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(name, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckSameFile(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	// The temporary directory could be a symlink.
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inside := filepath.Join(dir, "root", "foo.jpg")
+	writeTestFile(t, inside, testdata.Medium.Data)
+	outside := filepath.Join(dir, "outside.jpg")
+	writeTestFile(t, outside, testdata.Medium.Data)
+	fi, err := os.Stat(inside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkSameFile(inside, fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file opened through a replaced path component.
+	outsideFi, err := os.Stat(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkSameFile(inside, outsideFi)
+	if err != errFileChanged {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// A path component replaced by a symlink.
+	err = os.Rename(filepath.Join(dir, "root"), filepath.Join(dir, "root2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(dir, "root2"), filepath.Join(dir, "root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkSameFile(inside, fi)
+	if err != errFileChanged {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package graphicsmagick
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -51,6 +52,13 @@ type Handler struct {
 
 // Handle implements imageserver.Handler.
 func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+//
+// The process is killed if the context is done.
+func (hdr *Handler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	if !params.Has(param) {
 		return im, nil
 	}
@@ -61,7 +69,7 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 	if params.Empty() {
 		return im, nil
 	}
-	im, err = hdr.handle(im, params)
+	im, err = hdr.handle(ctx, im, params)
 	if err != nil {
 		if err, ok := err.(*imageserver.ParamError); ok {
 			err.Param = param + "." + err.Param
@@ -71,7 +79,7 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 	return im, nil
 }
 
-func (hdr *Handler) handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+func (hdr *Handler) handle(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	arguments := list.New()
 
 	width, height, err := hdr.buildArgumentsResize(arguments, params)
@@ -120,7 +128,7 @@ func (hdr *Handler) handle(im *imageserver.Image, params imageserver.Params) (*i
 
 	argumentSlice := convertArgumentsToSlice(arguments)
 	cmd := exec.Command(hdr.Executable, argumentSlice...)
-	err = hdr.runCommand(cmd)
+	err = hdr.runCommand(ctx, cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -313,7 +321,7 @@ func convertArgumentsToSlice(arguments *list.List) []string {
 	return argumentSlice
 }
 
-func (hdr *Handler) runCommand(cmd *exec.Cmd) error {
+func (hdr *Handler) runCommand(ctx context.Context, cmd *exec.Cmd) error {
 	err := cmd.Start()
 	if err != nil {
 		return err
@@ -331,6 +339,10 @@ func (hdr *Handler) runCommand(cmd *exec.Cmd) error {
 	case <-timeoutChan:
 		cmd.Process.Kill()
 		err = fmt.Errorf("timeout after %s", hdr.Timeout)
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-cmdChan
+		return ctx.Err()
 	}
 	if err != nil {
 		return &imageserver.ImageError{Message: fmt.Sprintf("GraphicsMagick command: %s", err)}
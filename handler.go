@@ -1,5 +1,9 @@
 package imageserver
 
+import (
+	"context"
+)
+
 // Handler handles an Image and returns an Image.
 type Handler interface {
 	Handle(*Image, Params) (*Image, error)
@@ -21,11 +25,16 @@ type HandlerServer struct {
 
 // Get implements Server.
 func (srv *HandlerServer) Get(params Params) (*Image, error) {
-	im, err := srv.Server.Get(params)
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements ContextServer.
+func (srv *HandlerServer) GetContext(ctx context.Context, params Params) (*Image, error) {
+	im, err := GetWithContext(ctx, srv.Server, params)
 	if err != nil {
 		return nil, err
 	}
-	im, err = srv.Handler.Handle(im, params)
+	im, err = HandleWithContext(ctx, srv.Handler, im, params)
 	if err != nil {
 		return nil, err
 	}
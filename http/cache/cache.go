@@ -0,0 +1,108 @@
+// Package cache provides a purge net/http.Handler for imageserver/cache.
+package cache
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+// TagParam is the HTTP query param that contains the tag to purge.
+const TagParam = "tag"
+
+// PurgeHandler is a net/http.Handler implementation that deletes an Image from a Cache.
+//
+// The request has the same URL (and headers) as the request used to get the Image:
+// the Params are parsed by Parser, and the key is computed by KeyGenerator.
+// They must be the same as the ones used by the imageserver/http.Handler and the imageserver/cache.Server.
+//
+// If the "tag" HTTP query param is set, all the entries associated to the tag are deleted (see imageserver/cache.TagIndex).
+// In this case, the request is not parsed, and TagIndex must be set.
+//
+// Authorize is called before anything else.
+// If it is not set, all requests are rejected.
+//
+// Supported methods are: POST, DELETE and PURGE.
+// It returns a 204 No Content response if the Image is deleted (or not in the Cache).
+// It returns a 401 Unauthorized response if the request is not authorized.
+// It returns a 501 Not Implemented response if the Cache doesn't implement imageserver/cache.Deleter, or if TagIndex is not set for a tag.
+// Other errors are handled like imageserver/http.Handler.
+type PurgeHandler struct {
+	// Parser parses the HTTP request and fills the Params.
+	Parser imageserver_http.Parser
+
+	// Cache is the Cache to purge.
+	Cache imageserver_cache.Cache
+
+	// KeyGenerator generates the cache key.
+	KeyGenerator imageserver_cache.KeyGenerator
+
+	// TagIndex is an optional index of the keys by tag.
+	TagIndex imageserver_cache.TagIndex
+
+	// Authorize returns true if the request is authorized.
+	Authorize func(*http.Request) bool
+
+	// ErrorFunc is an optional function that is called if there is an internal error.
+	ErrorFunc func(err error, req *http.Request)
+}
+
+// ServeHTTP implements net/http.Handler.
+func (handler *PurgeHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	err := handler.serveHTTP(rw, req)
+	if err != nil {
+		imageserver_http.SendError(rw, req, err, handler.Parser, handler.ErrorFunc)
+	}
+}
+
+func (handler *PurgeHandler) serveHTTP(rw http.ResponseWriter, req *http.Request) error {
+	if handler.Authorize == nil || !handler.Authorize(req) {
+		return imageserver_http.NewErrorDefaultText(http.StatusUnauthorized)
+	}
+	if req.Method != "POST" && req.Method != "DELETE" && req.Method != "PURGE" {
+		return imageserver_http.NewErrorDefaultText(http.StatusMethodNotAllowed)
+	}
+	err := handler.delete(req)
+	if err != nil {
+		if err == imageserver_cache.ErrDeleteNotSupported {
+			return imageserver_http.NewErrorDefaultText(http.StatusNotImplemented)
+		}
+		return err
+	}
+	rw.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler *PurgeHandler) delete(req *http.Request) error {
+	if tag := req.URL.Query().Get(TagParam); tag != "" {
+		if handler.TagIndex == nil {
+			return imageserver_http.NewErrorDefaultText(http.StatusNotImplemented)
+		}
+		return imageserver_cache.DeleteTag(handler.Cache, handler.TagIndex, tag)
+	}
+	params := imageserver.Params{}
+	err := handler.Parser.Parse(req, params)
+	if err != nil {
+		return err
+	}
+	key := handler.KeyGenerator.GetKey(params)
+	return imageserver_cache.Delete(handler.Cache, key)
+}
+
+// NewTokenAuthorizer returns a PurgeHandler.Authorize func that checks the "Authorization: Bearer <token>" header.
+//
+// The tokens are compared in constant time.
+func NewTokenAuthorizer(token string) func(*http.Request) bool {
+	return func(req *http.Request) bool {
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return false
+		}
+		t := strings.TrimPrefix(auth, "Bearer ")
+		return token != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1
+	}
+}
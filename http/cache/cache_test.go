@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+	cachetest "github.com/pierrre/imageserver/cache/_test"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ http.Handler = &PurgeHandler{}
+
+func newTestPurgeHandler(c imageserver_cache.Cache) *PurgeHandler {
+	return &PurgeHandler{
+		Parser:       &imageserver_http.SourceParser{},
+		Cache:        c,
+		KeyGenerator: imageserver_cache.NewParamsHashKeyGenerator(sha256.New),
+		Authorize:    NewTokenAuthorizer("secret"),
+	}
+}
+
+func TestPurgeHandler(t *testing.T) {
+	c := cachetest.NewMapCache()
+	h := newTestPurgeHandler(c)
+	key := h.KeyGenerator.GetKey(imageserver.Params{imageserver.SourceParam: testdata.MediumFileName})
+	err := c.Set(key, testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("PURGE", "http://localhost?source="+testdata.MediumFileName, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+	im, err := c.Get(key, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im != nil {
+		t.Fatal("image not deleted")
+	}
+}
+
+func TestPurgeHandlerError(t *testing.T) {
+	for _, tc := range []struct {
+		method       string
+		auth         string
+		cache        imageserver_cache.Cache
+		expectedCode int
+	}{
+		{"POST", "", nil, http.StatusUnauthorized},
+		{"POST", "Bearer invalid", nil, http.StatusUnauthorized},
+		{"POST", "secret", nil, http.StatusUnauthorized},
+		{"GET", "Bearer secret", nil, http.StatusMethodNotAllowed},
+		{"DELETE", "Bearer secret", &imageserver_cache.Func{}, http.StatusNotImplemented},
+		{"DELETE", "Bearer secret", &imageserver_cache.IgnoreError{Cache: &imageserver_cache.Func{}}, http.StatusNotImplemented},
+		{"DELETE", "Bearer secret", &imageserver_cache.IgnoreError{Cache: &imageserver_cache.Func{
+			DeleteFunc: func(key string) error { return errors.New("error") },
+		}}, http.StatusInternalServerError},
+	} {
+		c := tc.cache
+		if c == nil {
+			c = cachetest.NewMapCache()
+		}
+		h := newTestPurgeHandler(c)
+		req := httptest.NewRequest(tc.method, "http://localhost?source=foo", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.expectedCode {
+			t.Fatalf("unexpected http status for %#v: got %d, want %d", tc, w.Code, tc.expectedCode)
+		}
+	}
+}
+
+func TestPurgeHandlerNoAuthorize(t *testing.T) {
+	h := newTestPurgeHandler(cachetest.NewMapCache())
+	h.Authorize = nil
+	req := httptest.NewRequest("POST", "http://localhost?source=foo", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+}
+
+func TestPurgeHandlerTag(t *testing.T) {
+	c := cachetest.NewMapCache()
+	idx := imageserver_cache.NewMemoryTagIndex()
+	for _, key := range []string{"k1", "k2"} {
+		c.Set(key, testdata.Medium, imageserver.Params{})
+		idx.AddTags(key, []string{"foo"})
+	}
+	h := newTestPurgeHandler(c)
+	h.TagIndex = idx
+	req := httptest.NewRequest("POST", "http://localhost?tag=foo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+	for _, key := range []string{"k1", "k2"} {
+		im, _ := c.Get(key, imageserver.Params{})
+		if im != nil {
+			t.Fatalf("image %s not deleted", key)
+		}
+	}
+}
+
+func TestPurgeHandlerTagNoIndex(t *testing.T) {
+	h := newTestPurgeHandler(cachetest.NewMapCache())
+	req := httptest.NewRequest("POST", "http://localhost?tag=foo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+}
@@ -0,0 +1,193 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/pierrre/imageserver"
+)
+
+// DPRParam is the param that contains the device pixel ratio of the output Image (see ClientHintsParser).
+const DPRParam = "dpr"
+
+// DefaultClientHintsResizeParams contains the default names of the params updated by ClientHintsParser.
+var DefaultClientHintsResizeParams = []string{"gift_resize", "nfntresize"}
+
+var (
+	clientHintsDPRHeaders           = []string{"Sec-CH-DPR", "DPR"}
+	clientHintsWidthHeaders         = []string{"Sec-CH-Width", "Width"}
+	clientHintsViewportWidthHeaders = []string{"Sec-CH-Viewport-Width", "Viewport-Width"}
+	clientHintsVary                 = []string{"Sec-CH-DPR", "Sec-CH-Width", "Sec-CH-Viewport-Width", "DPR", "Width", "Viewport-Width"}
+)
+
+// ClientHintsParser is a Parser implementation that updates the resize params with the Client Hints of the HTTP request.
+//
+// It calls the underlying Parser, then updates the resize params (see ResizeParams):
+//  - If the width or the height is set, it is multiplied by the device pixel ratio ("Sec-CH-DPR" or "DPR" header).
+//  - Otherwise, the width is set to the "Sec-CH-Width"/"Width" header (in physical pixels),
+//    or to the "Sec-CH-Viewport-Width"/"Viewport-Width" header (in CSS pixels) multiplied by the device pixel ratio.
+// If no resize param is set, the first one of ResizeParams is created.
+// The size is limited to MaxWidth and MaxHeight, and the aspect ratio is kept.
+// Invalid hints are ignored.
+//
+// If the hints are used, the device pixel ratio of the output Image is stored in the "dpr" param.
+//
+// It implements VaryParser and ResponseHeaderParser, so Handler sets the "Vary", "Accept-CH" and "Content-DPR" headers.
+type ClientHintsParser struct {
+	Parser
+
+	// ResizeParams contains the names of the params that contain the "width" and "height" params.
+	// DefaultClientHintsResizeParams is used by default.
+	ResizeParams []string
+
+	// MaxWidth and MaxHeight are the optional maximum output size.
+	// They should be the same as the processors' values.
+	MaxWidth  int
+	MaxHeight int
+}
+
+// Parse implements Parser.
+func (parser *ClientHintsParser) Parse(req *http.Request, params imageserver.Params) error {
+	err := parser.Parser.Parse(req, params)
+	if err != nil {
+		return err
+	}
+	dpr, _ := getClientHintFloat(req, clientHintsDPRHeaders)
+	if dpr <= 0 {
+		dpr = 1
+	}
+	resizeParams := parser.ResizeParams
+	if resizeParams == nil {
+		resizeParams = DefaultClientHintsResizeParams
+	}
+	found := false
+	for _, name := range resizeParams {
+		if !params.Has(name) {
+			continue
+		}
+		found = true
+		resize, err := params.GetParams(name)
+		if err != nil {
+			return err
+		}
+		err = parser.update(req, params, resize, name, dpr)
+		if err != nil {
+			return err
+		}
+	}
+	if !found && len(resizeParams) > 0 {
+		resize := imageserver.Params{}
+		err = parser.update(req, params, resize, resizeParams[0], dpr)
+		if err != nil {
+			return err
+		}
+		if !resize.Empty() {
+			params.Set(resizeParams[0], resize)
+		}
+	}
+	return nil
+}
+
+func (parser *ClientHintsParser) update(req *http.Request, params imageserver.Params, resize imageserver.Params, name string, dpr float64) error {
+	width, err := getClientHintsDimension(resize, name, "width")
+	if err != nil {
+		return err
+	}
+	height, err := getClientHintsDimension(resize, name, "height")
+	if err != nil {
+		return err
+	}
+	var targetWidth, targetHeight float64
+	if width > 0 || height > 0 {
+		if dpr == 1 {
+			return nil
+		}
+		targetWidth, targetHeight = float64(width)*dpr, float64(height)*dpr
+	} else if w, ok := getClientHintFloat(req, clientHintsWidthHeaders); ok && w > 0 {
+		targetWidth = w
+	} else if vw, ok := getClientHintFloat(req, clientHintsViewportWidthHeaders); ok && vw > 0 {
+		targetWidth = vw * dpr
+	} else {
+		return nil
+	}
+	scale := 1.0
+	if parser.MaxWidth > 0 && targetWidth > float64(parser.MaxWidth) {
+		scale = float64(parser.MaxWidth) / targetWidth
+	}
+	if parser.MaxHeight > 0 && targetHeight*scale > float64(parser.MaxHeight) {
+		scale = float64(parser.MaxHeight) / targetHeight
+	}
+	if targetWidth > 0 {
+		resize.Set("width", roundDimension(targetWidth*scale))
+	}
+	if targetHeight > 0 {
+		resize.Set("height", roundDimension(targetHeight*scale))
+	}
+	params.Set(DPRParam, dpr*scale)
+	return nil
+}
+
+func getClientHintsDimension(resize imageserver.Params, name string, dimension string) (int, error) {
+	if !resize.Has(dimension) {
+		return 0, nil
+	}
+	v, err := resize.GetInt(dimension)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = name + "." + err.Param
+		}
+		return 0, err
+	}
+	return v, nil
+}
+
+func roundDimension(v float64) int {
+	d := int(math.Floor(v + 0.5))
+	if d < 1 {
+		d = 1
+	}
+	return d
+}
+
+// getClientHintFloat returns the value of the first valid header.
+func getClientHintFloat(req *http.Request, headers []string) (float64, bool) {
+	for _, h := range headers {
+		s := req.Header.Get(h)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		return v, true
+	}
+	return 0, false
+}
+
+// Resolve implements Parser.
+func (parser *ClientHintsParser) Resolve(param string) string {
+	return parser.Parser.Resolve(param)
+}
+
+// Vary implements VaryParser.
+func (parser *ClientHintsParser) Vary() []string {
+	return appendVary(GetVary(parser.Parser), clientHintsVary...)
+}
+
+// SetResponseHeader implements ResponseHeaderParser.
+//
+// It sets the "Accept-CH" header, and the "Content-DPR" header if the "dpr" param is set.
+func (parser *ClientHintsParser) SetResponseHeader(header http.Header, params imageserver.Params) {
+	if hp, ok := parser.Parser.(ResponseHeaderParser); ok {
+		hp.SetResponseHeader(header, params)
+	}
+	header.Set("Accept-CH", "Sec-CH-DPR, Sec-CH-Width, Sec-CH-Viewport-Width, DPR, Width, Viewport-Width")
+	if params.Has(DPRParam) {
+		dpr, err := params.GetFloat(DPRParam)
+		if err == nil {
+			header.Set("Content-DPR", strconv.FormatFloat(dpr, 'f', -1, 64))
+		}
+	}
+}
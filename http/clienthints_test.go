@@ -0,0 +1,207 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ Parser = &ClientHintsParser{}
+
+var _ VaryParser = &ClientHintsParser{}
+
+var _ ResponseHeaderParser = &ClientHintsParser{}
+
+type testResizeParser struct{}
+
+func (parser *testResizeParser) Parse(req *http.Request, params imageserver.Params) error {
+	resize := imageserver.Params{}
+	if err := ParseQueryInt("width", req, resize); err != nil {
+		return err
+	}
+	if err := ParseQueryInt("height", req, resize); err != nil {
+		return err
+	}
+	ParseQueryString("mode", req, resize)
+	if !resize.Empty() {
+		params.Set("gift_resize", resize)
+	}
+	return nil
+}
+
+func (parser *testResizeParser) Resolve(param string) string {
+	return ""
+}
+
+func TestClientHintsParserParse(t *testing.T) {
+	type TC struct {
+		parser         *ClientHintsParser
+		query          string
+		header         map[string]string
+		expectedParams imageserver.Params
+	}
+	for _, tc := range []TC{
+		{
+			expectedParams: imageserver.Params{},
+		},
+		{
+			query:          "width=100",
+			expectedParams: imageserver.Params{"gift_resize": imageserver.Params{"width": 100}},
+		},
+		{
+			query:  "width=100&height=50",
+			header: map[string]string{"Sec-CH-DPR": "2"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"width": 200, "height": 100},
+				DPRParam:      2.0,
+			},
+		},
+		{
+			query:  "height=50",
+			header: map[string]string{"DPR": "1.5"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"height": 75},
+				DPRParam:      1.5,
+			},
+		},
+		{
+			query:  "width=100",
+			header: map[string]string{"Sec-CH-DPR": "invalid", "DPR": "3"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"width": 300},
+				DPRParam:      3.0,
+			},
+		},
+		{
+			header: map[string]string{"Sec-CH-Width": "640", "Sec-CH-DPR": "2"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"width": 640},
+				DPRParam:      2.0,
+			},
+		},
+		{
+			query:  "mode=fit",
+			header: map[string]string{"Width": "640"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"width": 640, "mode": "fit"},
+				DPRParam:      1.0,
+			},
+		},
+		{
+			header: map[string]string{"Sec-CH-Viewport-Width": "400", "Sec-CH-DPR": "2"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"width": 800},
+				DPRParam:      2.0,
+			},
+		},
+		{
+			parser: &ClientHintsParser{Parser: &testResizeParser{}, MaxWidth: 500},
+			header: map[string]string{"Viewport-Width": "400", "DPR": "2"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"width": 500},
+				DPRParam:      1.25,
+			},
+		},
+		{
+			parser: &ClientHintsParser{Parser: &testResizeParser{}, MaxWidth: 1000, MaxHeight: 100},
+			query:  "width=200&height=100",
+			header: map[string]string{"DPR": "2"},
+			expectedParams: imageserver.Params{
+				"gift_resize": imageserver.Params{"width": 200, "height": 100},
+				DPRParam:      1.0,
+			},
+		},
+		{
+			parser: &ClientHintsParser{Parser: &testResizeParser{}, ResizeParams: []string{"nfntresize"}},
+			header: map[string]string{"Width": "320"},
+			expectedParams: imageserver.Params{
+				"nfntresize": imageserver.Params{"width": 320},
+				DPRParam:     1.0,
+			},
+		},
+		{
+			header:         map[string]string{"Width": "-1", "Viewport-Width": "invalid"},
+			expectedParams: imageserver.Params{},
+		},
+	} {
+		func() {
+			defer func() {
+				if t.Failed() {
+					t.Logf("%#v", tc)
+				}
+			}()
+			req, err := http.NewRequest("GET", "http://localhost?"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			parser := tc.parser
+			if parser == nil {
+				parser = &ClientHintsParser{Parser: &testResizeParser{}}
+			}
+			params := imageserver.Params{}
+			err = parser.Parse(req, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params.String() != tc.expectedParams.String() {
+				t.Fatalf("unexpected params: got %s, want %s", params, tc.expectedParams)
+			}
+		}()
+	}
+}
+
+func TestClientHintsParserParseError(t *testing.T) {
+	parser := &ClientHintsParser{Parser: &testResizeParser{}}
+	req, err := http.NewRequest("GET", "http://localhost?width=invalid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(req, imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	parser = &ClientHintsParser{Parser: ListParser{}}
+	err = parser.Parse(req, imageserver.Params{"gift_resize": "invalid"})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	err = parser.Parse(req, imageserver.Params{"gift_resize": imageserver.Params{"width": "invalid"}})
+	if err, ok := err.(*imageserver.ParamError); !ok || err.Param != "gift_resize.width" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClientHintsParserHandler(t *testing.T) {
+	h := &Handler{
+		Parser: &ClientHintsParser{
+			Parser: ListParser{
+				&SourceParser{},
+				&testResizeParser{},
+			},
+		},
+		Server: testdata.Server,
+	}
+	req := httptest.NewRequest("GET", "http://localhost?source=medium.jpg&width=100", nil)
+	req.Header.Set("Sec-CH-DPR", "2")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+	if v := w.Header().Get("Content-DPR"); v != "2" {
+		t.Fatalf("unexpected Content-DPR: got \"%s\", want \"2\"", v)
+	}
+	if v := w.Header().Get("Accept-CH"); !strings.Contains(v, "Sec-CH-DPR") {
+		t.Fatalf("unexpected Accept-CH: %s", v)
+	}
+	if v := w.Header().Get("Vary"); !strings.Contains(v, "Sec-CH-Width") || !strings.Contains(v, "Viewport-Width") {
+		t.Fatalf("unexpected Vary: %s", v)
+	}
+}
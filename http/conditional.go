@@ -0,0 +1,104 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkPreconditions evaluates the conditional headers of the request, as described in RFC 7232 section 6.
+//
+// It returns StatusOK/200 if the request must be processed normally,
+// StatusNotModified/304 or StatusPreconditionFailed/412 otherwise.
+// Conditions that need a missing validator (empty ETag or zero Last-Modified) are ignored.
+func checkPreconditions(req *http.Request, etag string, lastModified time.Time) int {
+	if im := req.Header.Get("If-Match"); im != "" {
+		if etag != "" && !matchETagList(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius, ok := parseHTTPTime(req.Header.Get("If-Unmodified-Since")); ok && !lastModified.IsZero() {
+		if lastModified.Truncate(time.Second).After(ius) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		if etag != "" && matchETagList(inm, etag, true) {
+			if req.Method == "GET" || req.Method == "HEAD" {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims, ok := parseHTTPTime(req.Header.Get("If-Modified-Since")); ok && !lastModified.IsZero() {
+		if (req.Method == "GET" || req.Method == "HEAD") && !lastModified.Truncate(time.Second).After(ims) {
+			return http.StatusNotModified
+		}
+	}
+	return http.StatusOK
+}
+
+func parseHTTPTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// matchETagList returns true if the ETag matches the list of the header ("*" matches any ETag).
+//
+// The weak comparison ignores the "W/" prefix, the strong comparison never matches a weak ETag.
+func matchETagList(header string, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, e := range parseETagList(header) {
+		if weak {
+			if strings.TrimPrefix(e, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(e, "W/") && !strings.HasPrefix(etag, "W/") && e == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETagList parses a comma separated list of ETags.
+//
+// Commas inside quoted ETags are supported, and invalid ETags are ignored.
+func parseETagList(header string) []string {
+	var etags []string
+	s := header
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return etags
+		}
+		weak := strings.HasPrefix(s, "W/")
+		if weak {
+			s = s[2:]
+		}
+		if !strings.HasPrefix(s, "\"") {
+			// Invalid ETag, skip to the next one.
+			i := strings.Index(s, ",")
+			if i < 0 {
+				return etags
+			}
+			s = s[i:]
+			continue
+		}
+		i := strings.Index(s[1:], "\"")
+		if i < 0 {
+			return etags
+		}
+		etag := s[:i+2]
+		if weak {
+			etag = "W/" + etag
+		}
+		etags = append(etags, etag)
+		s = s[i+2:]
+	}
+}
@@ -0,0 +1,201 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestParseETagList(t *testing.T) {
+	for _, tc := range []struct {
+		header   string
+		expected []string
+	}{
+		{"", nil},
+		{`"a"`, []string{`"a"`}},
+		{`"a", "b",W/"c"`, []string{`"a"`, `"b"`, `W/"c"`}},
+		{`"a,b" , "c"`, []string{`"a,b"`, `"c"`}},
+		{`invalid, "a"`, []string{`"a"`}},
+		{`"a", "unterminated`, []string{`"a"`}},
+		{`invalid`, nil},
+	} {
+		res := parseETagList(tc.header)
+		if fmt.Sprint(res) != fmt.Sprint(tc.expected) {
+			t.Fatalf("unexpected result for %s: got %v, want %v", tc.header, res, tc.expected)
+		}
+	}
+}
+
+func TestMatchETagList(t *testing.T) {
+	for _, tc := range []struct {
+		header   string
+		etag     string
+		weak     bool
+		expected bool
+	}{
+		{`*`, `"a"`, false, true},
+		{`"a"`, `"a"`, false, true},
+		{`"b", "a"`, `"a"`, false, true},
+		{`"b"`, `"a"`, false, false},
+		{`W/"a"`, `"a"`, false, false},
+		{`W/"a"`, `"a"`, true, true},
+		{`"a"`, `W/"a"`, true, true},
+		{`"a"`, `W/"a"`, false, false},
+	} {
+		res := matchETagList(tc.header, tc.etag, tc.weak)
+		if res != tc.expected {
+			t.Fatalf("unexpected result for %s %s (weak=%t): got %t, want %t", tc.header, tc.etag, tc.weak, res, tc.expected)
+		}
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	lastModified := time.Date(2020, time.January, 2, 3, 4, 5, 600, time.UTC)
+	before := lastModified.Add(-time.Hour).Format(http.TimeFormat)
+	same := lastModified.Format(http.TimeFormat)
+	for _, tc := range []struct {
+		method       string
+		header       map[string]string
+		etag         string
+		lastModified time.Time
+		expected     int
+	}{
+		{expected: http.StatusOK},
+		{header: map[string]string{"If-None-Match": `"a"`}, expected: http.StatusOK},
+		{header: map[string]string{"If-None-Match": `"a"`}, etag: `"a"`, expected: http.StatusNotModified},
+		{header: map[string]string{"If-None-Match": `"b", W/"a"`}, etag: `"a"`, expected: http.StatusNotModified},
+		{header: map[string]string{"If-None-Match": `*`}, etag: `"a"`, expected: http.StatusNotModified},
+		{header: map[string]string{"If-None-Match": `"b"`}, etag: `"a"`, expected: http.StatusOK},
+		{method: "POST", header: map[string]string{"If-None-Match": `"a"`}, etag: `"a"`, expected: http.StatusPreconditionFailed},
+		{header: map[string]string{"If-Match": `"a"`}, etag: `"a"`, expected: http.StatusOK},
+		{header: map[string]string{"If-Match": `W/"a"`}, etag: `"a"`, expected: http.StatusPreconditionFailed},
+		{header: map[string]string{"If-Match": `"b"`}, etag: `"a"`, expected: http.StatusPreconditionFailed},
+		{header: map[string]string{"If-Match": `"b"`}, expected: http.StatusOK},
+		{header: map[string]string{"If-Modified-Since": same}, lastModified: lastModified, expected: http.StatusNotModified},
+		{header: map[string]string{"If-Modified-Since": before}, lastModified: lastModified, expected: http.StatusOK},
+		{header: map[string]string{"If-Modified-Since": same}, expected: http.StatusOK},
+		{header: map[string]string{"If-Modified-Since": "invalid"}, lastModified: lastModified, expected: http.StatusOK},
+		{header: map[string]string{"If-Modified-Since": same, "If-None-Match": `"b"`}, etag: `"a"`, lastModified: lastModified, expected: http.StatusOK},
+		{header: map[string]string{"If-Unmodified-Since": same}, lastModified: lastModified, expected: http.StatusOK},
+		{header: map[string]string{"If-Unmodified-Since": before}, lastModified: lastModified, expected: http.StatusPreconditionFailed},
+		{header: map[string]string{"If-Unmodified-Since": before, "If-Match": `"a"`}, etag: `"a"`, lastModified: lastModified, expected: http.StatusOK},
+	} {
+		method := tc.method
+		if method == "" {
+			method = "GET"
+		}
+		req := httptest.NewRequest(method, "http://localhost", nil)
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		res := checkPreconditions(req, tc.etag, tc.lastModified)
+		if res != tc.expected {
+			t.Fatalf("unexpected result for %s %v (etag=%s, last modified=%s): got %d, want %d", method, tc.header, tc.etag, tc.lastModified, res, tc.expected)
+		}
+	}
+}
+
+func TestHandlerLastModified(t *testing.T) {
+	lastModified := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: testdata.Server,
+		LastModifiedFunc: func(params imageserver.Params) time.Time {
+			return lastModified
+		},
+	}
+	req := httptest.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+	if v := w.Header().Get("Last-Modified"); v != lastModified.Format(http.TimeFormat) {
+		t.Fatalf("unexpected Last-Modified: %s", v)
+	}
+	req.Header.Set("If-Modified-Since", lastModified.Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatal("unexpected body")
+	}
+}
+
+func TestHandlerPreconditionFailed(t *testing.T) {
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+			t.Fatal("server called")
+			return nil, nil
+		}),
+		ETagFunc: func(params imageserver.Params) string {
+			return "a"
+		},
+	}
+	req := httptest.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	req.Header.Set("If-Match", `"b"`)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+}
+
+func TestHandlerRange(t *testing.T) {
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: testdata.Server,
+		ETagFunc: func(params imageserver.Params) string {
+			return "a"
+		},
+	}
+	for _, tc := range []struct {
+		header       map[string]string
+		expectedCode int
+		expectedLen  int
+	}{
+		{
+			header:       map[string]string{"Range": "bytes=0-99"},
+			expectedCode: http.StatusPartialContent,
+			expectedLen:  100,
+		},
+		{
+			header:       map[string]string{"Range": "bytes=10-19", "If-Range": `"a"`},
+			expectedCode: http.StatusPartialContent,
+			expectedLen:  10,
+		},
+		{
+			header:       map[string]string{"Range": "bytes=10-19", "If-Range": `"b"`},
+			expectedCode: http.StatusOK,
+			expectedLen:  len(testdata.Medium.Data),
+		},
+		{
+			header:       map[string]string{"Range": fmt.Sprintf("bytes=%d-", len(testdata.Medium.Data))},
+			expectedCode: http.StatusRequestedRangeNotSatisfiable,
+		},
+	} {
+		req := httptest.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.expectedCode {
+			t.Fatalf("unexpected http status for %v: got %d, want %d", tc.header, w.Code, tc.expectedCode)
+		}
+		if tc.expectedLen != 0 && w.Body.Len() != tc.expectedLen {
+			t.Fatalf("unexpected body length for %v: got %d, want %d", tc.header, w.Body.Len(), tc.expectedLen)
+		}
+		if tc.expectedCode == http.StatusPartialContent && w.Header().Get("Content-Type") != "image/jpeg" {
+			t.Fatalf("unexpected Content-Type: %s", w.Header().Get("Content-Type"))
+		}
+	}
+}
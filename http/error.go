@@ -1,8 +1,13 @@
 package http
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+
+	"github.com/pierrre/imageserver"
 )
 
 // Error is a HTTP error.
@@ -21,3 +26,55 @@ func NewErrorDefaultText(code int) *Error {
 func (err *Error) Error() string {
 	return fmt.Sprintf("http error %d: %s", err.Code, err.Text)
 }
+
+// SendError sends an error response, as described in Handler.
+//
+// The Parser is optional, and is used to resolve the HTTP param of a *imageserver.ParamError.
+// The errorFunc is optional, and is called if there is an internal error.
+//
+// It can be used by other net/http.Handler implementations to handle errors like Handler.
+func SendError(rw http.ResponseWriter, req *http.Request, err error, parser Parser, errorFunc func(error, *http.Request)) {
+	if err, ok := err.(*imageserver.LimitError); ok && err.RetryAfter > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+	httpErr := ConvertError(err, req, parser, errorFunc)
+	http.Error(rw, httpErr.Text, httpErr.Code)
+}
+
+// ConvertError converts an error to an *Error, as described in Handler.
+//
+// The Parser and errorFunc are used like SendError.
+func ConvertError(err error, req *http.Request, parser Parser, errorFunc func(error, *http.Request)) *Error {
+	switch err {
+	case context.Canceled:
+		// The client is gone, so it's not an internal error.
+		return NewErrorDefaultText(http.StatusServiceUnavailable)
+	case context.DeadlineExceeded:
+		// The request took too long, it's not an internal error either.
+		return NewErrorDefaultText(http.StatusGatewayTimeout)
+	}
+	switch err := err.(type) {
+	case *Error:
+		return err
+	case *imageserver.ParamError:
+		httpParam := ""
+		if parser != nil {
+			httpParam = parser.Resolve(err.Param)
+		}
+		if httpParam == "" {
+			httpParam = err.Param
+		}
+		text := fmt.Sprintf("invalid param \"%s\": %s", httpParam, err.Message)
+		return &Error{Code: http.StatusBadRequest, Text: text}
+	case *imageserver.ImageError:
+		text := fmt.Sprintf("image error: %s", err.Message)
+		return &Error{Code: http.StatusBadRequest, Text: text}
+	case *imageserver.LimitError:
+		return NewErrorDefaultText(http.StatusServiceUnavailable)
+	default:
+		if errorFunc != nil {
+			errorFunc(err, req)
+		}
+		return NewErrorDefaultText(http.StatusInternalServerError)
+	}
+}
@@ -42,6 +42,7 @@ func (prs *RotateParser) parse(req *http.Request, params imageserver.Params) err
 	}
 	imageserver_http.ParseQueryString("background", req, params)
 	imageserver_http.ParseQueryString("interpolation", req, params)
+	imageserver_http.ParseQueryString("flip", req, params)
 	return nil
 }
 
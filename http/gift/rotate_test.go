@@ -37,6 +37,12 @@ func TestRotateParserParse(t *testing.T) {
 				"background": "FF0000",
 			}},
 		},
+		{
+			query: url.Values{"flip": {"horizontal"}},
+			expectedParams: imageserver.Params{rotateParam: imageserver.Params{
+				"flip": "horizontal",
+			}},
+		},
 		{
 			query:              url.Values{"rotation": {"invalid"}},
 			expectedParamError: rotateParam + ".rotation",
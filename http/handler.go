@@ -2,13 +2,14 @@
 package http
 
 import (
+	"bytes"
 	"encoding/hex"
-	"fmt"
 	"hash"
 	"io"
 	"net/http"
-	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pierrre/imageserver"
 )
@@ -18,25 +19,39 @@ import (
 // Supported methods are: GET and HEAD.
 // Other method will return a StatusMethodNotAllowed/405 response.
 //
-// It supports ETag/If-None-Match headers and returns a StatusNotModified/304 response accordingly.
+// It supports the conditional requests (RFC 7232) with the ETag (see ETagFunc) and Last-Modified (see LastModifiedFunc) validators:
+// If-Match, If-Unmodified-Since, If-None-Match (with weak comparison) and If-Modified-Since.
+// They return a StatusNotModified/304 or StatusPreconditionFailed/412 response accordingly.
 // But it doesn't check if the Image really exists (the Server is not called).
 //
+// It supports the range requests (RFC 7233) with the Range and If-Range headers, on the encoded Image.
+//
+// The request's context.Context is forwarded to the Server, so a disconnected client cancels the processing.
+//
 // Steps:
 //  - Parse the HTTP request, and fill the Params.
-//  - If the given If-None-Match header matches the ETag, return a StatusNotModified/304 response.
+//  - Evaluate the conditional headers, and return a StatusNotModified/304 or StatusPreconditionFailed/412 response if needed.
 //  - Call the Server and get the Image.
-//  - Return a StatusOK/200 response containing the Image.
+//  - Return a StatusOK/200 (or StatusPartialContent/206) response containing the Image.
 //
 // Errors (returned by Parser or Server):
 //  - *imageserver/http.Error will return a response with the given status code and message.
 //  - *imageserver.ParamError will return a StatusBadRequest/400 response, with a message including the resolved HTTP param.
 //  - *imageserver.ImageError will return a StatusBadRequest/400 response, with the given message.
+//  - *imageserver.LimitError will return a StatusServiceUnavailable/503 response, with the "Retry-After" header if RetryAfter is set.
+//  - context.Canceled will return a StatusServiceUnavailable/503 response.
+//  - context.DeadlineExceeded will return a StatusGatewayTimeout/504 response.
 //  - Other error will return a StatusInternalServerError/500 response, and ErrorFunc will be called.
 //
 // Returned headers:
 //  - Content-Type is set for StatusOK/200 response, and contains "image/{Image.Format}".
 //  - Content-Length is set for StatusOK/200 response, and contains the Image size.
 //  - ETag is set for StatusOK/200 and StatusNotModified/304 response, and contains the ETag value.
+//  - Last-Modified is set for StatusOK/200 and StatusNotModified/304 response, if LastModifiedFunc returns a non-zero time.
+//  - Accept-Ranges is set for StatusOK/200 response, and contains "bytes".
+//  - Surrogate-Key is set for StatusOK/200 and StatusNotModified/304 response, if SurrogateKeyFunc returns keys.
+//  - Vary is set if the Parser implements VaryParser, and contains the HTTP request headers used by the Parser.
+//  - Other headers can be set by the Parser if it implements ResponseHeaderParser.
 type Handler struct {
 	// Parser parses the HTTP request and fills the Params.
 	Parser Parser
@@ -49,6 +64,16 @@ type Handler struct {
 	// The returned value must not be enclosed in quotes (they are added automatically).
 	ETagFunc func(params imageserver.Params) string
 
+	// LastModifiedFunc is an optional function that returns the last modification time for the given Params.
+	// The zero time means that it is unknown.
+	LastModifiedFunc func(params imageserver.Params) time.Time
+
+	// SurrogateKeyFunc is an optional function that returns the surrogate keys for the given Params.
+	// The CDN uses them to purge all the responses with a key (e.g. all the variants of a source).
+	// It can be imageserver/cache.Server.GetTags, so the CDN and the Cache use the same tags.
+	// The spaces in the keys are escaped as "%20", because the keys are separated by spaces.
+	SurrogateKeyFunc func(params imageserver.Params) []string
+
 	// ErrorFunc is an optional function that is called if there is an internal error.
 	ErrorFunc func(err error, req *http.Request)
 }
@@ -70,18 +95,47 @@ func (handler *Handler) serveHTTP(rw http.ResponseWriter, req *http.Request) err
 	if err != nil {
 		return err
 	}
+	if vary := GetVary(handler.Parser); len(vary) > 0 {
+		rw.Header().Set("Vary", strings.Join(vary, ", "))
+	}
+	if hp, ok := handler.Parser.(ResponseHeaderParser); ok {
+		hp.SetResponseHeader(rw.Header(), params)
+	}
 	etag := handler.getETag(params)
-	if handler.checkNotModified(rw, req, etag) {
+	lastModified := handler.getLastModified(params)
+	switch checkPreconditions(req, etag, lastModified) {
+	case http.StatusNotModified:
+		handler.setImageHeaderCommon(rw, req, etag, lastModified)
+		handler.setSurrogateKey(rw, params)
+		rw.WriteHeader(http.StatusNotModified)
 		return nil
+	case http.StatusPreconditionFailed:
+		return NewErrorDefaultText(http.StatusPreconditionFailed)
 	}
-	image, err := handler.Server.Get(params)
+	image, err := imageserver.GetWithContext(req.Context(), handler.Server, params)
 	if err != nil {
 		return err
 	}
-	handler.sendImage(rw, req, image, etag)
+	handler.setSurrogateKey(rw, params)
+	handler.sendImage(rw, req, image, etag, lastModified)
 	return nil
 }
 
+func (handler *Handler) setSurrogateKey(rw http.ResponseWriter, params imageserver.Params) {
+	if handler.SurrogateKeyFunc == nil {
+		return
+	}
+	keys := handler.SurrogateKeyFunc(params)
+	if len(keys) == 0 {
+		return
+	}
+	escaped := make([]string, len(keys))
+	for i, key := range keys {
+		escaped[i] = strings.Replace(key, " ", "%20", -1)
+	}
+	rw.Header().Set("Surrogate-Key", strings.Join(escaped, " "))
+}
+
 func (handler *Handler) getETag(params imageserver.Params) string {
 	if handler.ETagFunc != nil {
 		return "\"" + handler.ETagFunc(params) + "\""
@@ -89,61 +143,34 @@ func (handler *Handler) getETag(params imageserver.Params) string {
 	return ""
 }
 
-func (handler *Handler) checkNotModified(rw http.ResponseWriter, req *http.Request, etag string) bool {
-	if etag == "" {
-		return false
-	}
-	inm := req.Header.Get("If-None-Match")
-	if inm != etag {
-		return false
+func (handler *Handler) getLastModified(params imageserver.Params) time.Time {
+	if handler.LastModifiedFunc != nil {
+		return handler.LastModifiedFunc(params)
 	}
-	handler.setImageHeaderCommon(rw, req, etag)
-	rw.WriteHeader(http.StatusNotModified)
-	return true
+	return time.Time{}
 }
 
-func (handler *Handler) sendImage(rw http.ResponseWriter, req *http.Request, image *imageserver.Image, etag string) {
-	handler.setImageHeaderCommon(rw, req, etag)
+func (handler *Handler) sendImage(rw http.ResponseWriter, req *http.Request, image *imageserver.Image, etag string, lastModified time.Time) {
+	handler.setImageHeaderCommon(rw, req, etag, lastModified)
 	if image.Format != "" {
 		rw.Header().Set("Content-Type", "image/"+image.Format)
 	}
-	rw.Header().Set("Content-Length", strconv.Itoa(len(image.Data)))
-	if req.Method == "GET" {
-		rw.Write(image.Data)
-	}
+	// ServeContent handles the Range and If-Range headers.
+	// The other conditional headers have already been checked, so it doesn't send another StatusNotModified/304 response.
+	http.ServeContent(rw, req, "", lastModified, bytes.NewReader(image.Data))
 }
 
-func (handler *Handler) setImageHeaderCommon(rw http.ResponseWriter, req *http.Request, etag string) {
+func (handler *Handler) setImageHeaderCommon(rw http.ResponseWriter, req *http.Request, etag string, lastModified time.Time) {
 	if etag != "" {
 		rw.Header().Set("ETag", etag)
 	}
+	if !lastModified.IsZero() {
+		rw.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
 }
 
 func (handler *Handler) sendError(rw http.ResponseWriter, req *http.Request, err error) {
-	httpErr := handler.convertGenericErrorToHTTP(err, req)
-	http.Error(rw, httpErr.Text, httpErr.Code)
-}
-
-func (handler *Handler) convertGenericErrorToHTTP(err error, req *http.Request) *Error {
-	switch err := err.(type) {
-	case *Error:
-		return err
-	case *imageserver.ParamError:
-		httpParam := handler.Parser.Resolve(err.Param)
-		if httpParam == "" {
-			httpParam = err.Param
-		}
-		text := fmt.Sprintf("invalid param \"%s\": %s", httpParam, err.Message)
-		return &Error{Code: http.StatusBadRequest, Text: text}
-	case *imageserver.ImageError:
-		text := fmt.Sprintf("image error: %s", err.Message)
-		return &Error{Code: http.StatusBadRequest, Text: text}
-	default:
-		if handler.ErrorFunc != nil {
-			handler.ErrorFunc(err, req)
-		}
-		return NewErrorDefaultText(http.StatusInternalServerError)
-	}
+	SendError(rw, req, err, handler.Parser, handler.ErrorFunc)
 }
 
 // NewParamsHashETagFunc returns a function that hashes the params and returns an ETag value.
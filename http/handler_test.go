@@ -1,11 +1,13 @@
 package http
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/pierrre/imageserver"
 	"github.com/pierrre/imageserver/testdata"
@@ -124,6 +126,33 @@ func TestHandler(t *testing.T) {
 			expectedStatusCode:    http.StatusInternalServerError,
 			expectErrorFuncCalled: true,
 		},
+		{
+			url: "http://localhost",
+			server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+				return nil, &imageserver.LimitError{
+					Message:    "error",
+					RetryAfter: 1500 * time.Millisecond,
+				}
+			}),
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedHeader: map[string]string{
+				"Retry-After": "2",
+			},
+		},
+		{
+			url: "http://localhost",
+			server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+				return nil, context.Canceled
+			}),
+			expectedStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			url: "http://localhost",
+			server: imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+				return nil, context.DeadlineExceeded
+			}),
+			expectedStatusCode: http.StatusGatewayTimeout,
+		},
 	} {
 		func() {
 			defer func() {
@@ -184,6 +213,9 @@ func TestHandler(t *testing.T) {
 			if tc.expectErrorFuncCalled && !errorFuncCalled {
 				t.Fatal("ErrorFunc not called")
 			}
+			if !tc.expectErrorFuncCalled && errorFuncCalled {
+				t.Fatal("ErrorFunc called")
+			}
 		}()
 	}
 }
@@ -193,3 +225,76 @@ func TestNewParamsHashETagFunc(t *testing.T) {
 		"foo": "bar",
 	})
 }
+
+func TestHandlerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: imageserver.ContextServerFunc(func(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+		ErrorFunc: func(err error, req *http.Request) {
+			t.Fatalf("unexpected error: %v", err)
+		},
+	}
+	req, err := http.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(ctx)
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	if rw.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status code: got %d, want %d", rw.Code, http.StatusServiceUnavailable)
+	}
+}
+
+type testVaryParser struct {
+	SourceParser
+	vary []string
+}
+
+func (parser *testVaryParser) Vary() []string {
+	return parser.vary
+}
+
+func TestHandlerVary(t *testing.T) {
+	h := &Handler{
+		Parser: ListParser{
+			&testVaryParser{vary: []string{"Accept"}},
+			&testVaryParser{vary: []string{"accept", "DPR"}},
+		},
+		Server: testdata.Server,
+	}
+	req := httptest.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept, DPR" {
+		t.Fatalf("unexpected vary: got \"%s\", want \"%s\"", vary, "Accept, DPR")
+	}
+}
+
+func TestHandlerSurrogateKey(t *testing.T) {
+	h := &Handler{
+		Parser: &SourceParser{},
+		Server: testdata.Server,
+		SurrogateKeyFunc: func(params imageserver.Params) []string {
+			return []string{"foo bar", "baz"}
+		},
+	}
+	req := httptest.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+	if v := w.Header().Get("Surrogate-Key"); v != "foo%20bar baz" {
+		t.Fatalf("unexpected Surrogate-Key: %s", v)
+	}
+}
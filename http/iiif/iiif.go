@@ -0,0 +1,385 @@
+// Package iiif provides imageserver/http implementations for the IIIF Image API 3.0.
+//
+// See https://iiif.io/api/image/3.0/ .
+package iiif
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF decoder
+	_ "image/jpeg" // Register JPEG decoder
+	_ "image/png"  // Register PNG decoder
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+)
+
+const (
+	cropParam   = "crop"
+	resizeParam = "gift_resize"
+	rotateParam = "gift_rotate"
+	pathParam   = "path"
+)
+
+// Parser is a imageserver/http.Parser implementation for the IIIF Image API 3.0.
+//
+// It parses the HTTP URL path with the following format:
+//  /{identifier}/{region}/{size}/{rotation}/{quality}.{format}
+//
+// The identifier can contain "/" (escaped or not), and is stored in the "source" param.
+//
+// Region (stored in the "crop" param, see imageserver/image/crop.Processor):
+//  - full
+//  - square
+//  - x,y,w,h
+//  - pct:x,y,w,h
+//
+// Size (stored in the "gift_resize" param, see imageserver/image/gift.ResizeProcessor):
+//  - max
+//  - w,
+//  - ,h
+//  - pct:n
+//  - w,h
+//  - !w,h (with the "fit" mode)
+// The "^" prefix (upscaling) is accepted, but upscaling is never rejected.
+//
+// Rotation (stored in the "gift_rotate" param, see imageserver/image/gift.RotateProcessor):
+//  - n: clockwise rotation in degrees
+//  - !n: horizontal mirroring, then rotation
+//
+// Quality: only "default" and "color" are supported.
+//
+// Format: stored in the "format" param.
+//
+// The "square" and "pct:" values require the source dimensions, so Server must be set to use them.
+type Parser struct {
+	// Server is an optional imageserver.Server that returns the source Image (only the "source" param is given).
+	Server imageserver.Server
+}
+
+// Parse implements imageserver/http.Parser.
+func (prs *Parser) Parse(req *http.Request, params imageserver.Params) error {
+	segments := strings.Split(strings.TrimPrefix(req.URL.EscapedPath(), "/"), "/")
+	if len(segments) < 5 {
+		return &imageserver.ParamError{Param: pathParam, Message: "expected format \"/{identifier}/{region}/{size}/{rotation}/{quality}.{format}\""}
+	}
+	n := len(segments) - 4
+	for i := n; i < len(segments); i++ {
+		s, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return &imageserver.ParamError{Param: pathParam, Message: err.Error()}
+		}
+		segments[i] = s
+	}
+	source, err := unescapeIdentifier(strings.Join(segments[:n], "/"))
+	if err != nil {
+		return err
+	}
+	params.Set(imageserver.SourceParam, source)
+	p := &parser{
+		ctx:    req.Context(),
+		server: prs.Server,
+		source: source,
+		params: params,
+	}
+	return p.parse(segments[n], segments[n+1], segments[n+2], segments[n+3])
+}
+
+func unescapeIdentifier(s string) (string, error) {
+	if s == "" {
+		return "", &imageserver.ParamError{Param: imageserver.SourceParam, Message: "missing"}
+	}
+	source, err := url.PathUnescape(s)
+	if err != nil {
+		return "", &imageserver.ParamError{Param: imageserver.SourceParam, Message: err.Error()}
+	}
+	return source, nil
+}
+
+type parser struct {
+	ctx    context.Context
+	server imageserver.Server
+	source string
+	params imageserver.Params
+
+	size   image.Point
+	region image.Rectangle
+}
+
+func (p *parser) parse(region, size, rotation, qualityFormat string) error {
+	err := p.parseRegion(region)
+	if err != nil {
+		return err
+	}
+	err = p.parseSize(size)
+	if err != nil {
+		return err
+	}
+	err = p.parseRotation(rotation)
+	if err != nil {
+		return err
+	}
+	return p.parseQualityFormat(qualityFormat)
+}
+
+// getSourceSize returns the size of the source Image.
+// The Server is called only once.
+func (p *parser) getSourceSize(param string) (image.Point, error) {
+	if p.size != image.ZP {
+		return p.size, nil
+	}
+	if p.server == nil {
+		return image.ZP, &imageserver.ParamError{Param: param, Message: "not supported"}
+	}
+	size, err := getSourceSize(p.ctx, p.server, p.source)
+	if err != nil {
+		return image.ZP, err
+	}
+	p.size = size
+	return size, nil
+}
+
+func (p *parser) parseRegion(s string) error {
+	var err error
+	switch {
+	case s == "full":
+		return nil
+	case s == "square":
+		err = p.parseRegionSquare()
+	case strings.HasPrefix(s, "pct:"):
+		err = p.parseRegionPct(strings.TrimPrefix(s, "pct:"))
+	default:
+		err = p.parseRegionPixels(s)
+	}
+	if err != nil {
+		return err
+	}
+	if p.region.Dx() <= 0 || p.region.Dy() <= 0 {
+		return &imageserver.ParamError{Param: cropParam, Message: "width and height must be greater than 0"}
+	}
+	p.params.Set(cropParam, imageserver.Params{
+		"min_x": p.region.Min.X,
+		"min_y": p.region.Min.Y,
+		"max_x": p.region.Max.X,
+		"max_y": p.region.Max.Y,
+	})
+	return nil
+}
+
+func (p *parser) parseRegionSquare() error {
+	size, err := p.getSourceSize(cropParam)
+	if err != nil {
+		return err
+	}
+	d := size.X
+	if size.Y < d {
+		d = size.Y
+	}
+	min := image.Pt((size.X-d)/2, (size.Y-d)/2)
+	p.region = image.Rectangle{Min: min, Max: min.Add(image.Pt(d, d))}
+	return nil
+}
+
+func (p *parser) parseRegionPct(s string) error {
+	vs, err := parseFloats(s, 4, cropParam)
+	if err != nil {
+		return err
+	}
+	size, err := p.getSourceSize(cropParam)
+	if err != nil {
+		return err
+	}
+	x := pct(vs[0], size.X)
+	y := pct(vs[1], size.Y)
+	p.region = image.Rect(x, y, x+pct(vs[2], size.X), y+pct(vs[3], size.Y))
+	return nil
+}
+
+func (p *parser) parseRegionPixels(s string) error {
+	vs, err := parseInts(s, 4, cropParam)
+	if err != nil {
+		return err
+	}
+	p.region = image.Rect(vs[0], vs[1], vs[0]+vs[2], vs[1]+vs[3])
+	return nil
+}
+
+// getRegionSize returns the size of the region, or the size of the source Image if the region is full.
+func (p *parser) getRegionSize(param string) (image.Point, error) {
+	if p.region != image.ZR {
+		return p.region.Size(), nil
+	}
+	return p.getSourceSize(param)
+}
+
+func (p *parser) parseSize(s string) error {
+	s = strings.TrimPrefix(s, "^")
+	resize := imageserver.Params{}
+	switch {
+	case s == "max":
+		return nil
+	case strings.HasPrefix(s, "pct:"):
+		v, err := strconv.ParseFloat(strings.TrimPrefix(s, "pct:"), 64)
+		if err != nil || v <= 0 {
+			return &imageserver.ParamError{Param: resizeParam, Message: "invalid percentage"}
+		}
+		size, err := p.getRegionSize(resizeParam)
+		if err != nil {
+			return err
+		}
+		resize.Set("width", pct(v, size.X))
+		resize.Set("height", pct(v, size.Y))
+	case strings.HasPrefix(s, "!"):
+		vs, err := parseInts(strings.TrimPrefix(s, "!"), 2, resizeParam)
+		if err != nil {
+			return err
+		}
+		resize.Set("width", vs[0])
+		resize.Set("height", vs[1])
+		resize.Set("mode", "fit")
+	default:
+		err := parseSizeDimensions(s, resize)
+		if err != nil {
+			return err
+		}
+	}
+	p.params.Set(resizeParam, resize)
+	return nil
+}
+
+func parseSizeDimensions(s string, resize imageserver.Params) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 || (parts[0] == "" && parts[1] == "") {
+		return &imageserver.ParamError{Param: resizeParam, Message: "invalid format"}
+	}
+	for i, name := range []string{"width", "height"} {
+		if parts[i] == "" {
+			continue
+		}
+		v, err := strconv.Atoi(parts[i])
+		if err != nil || v <= 0 {
+			return &imageserver.ParamError{Param: resizeParam + "." + name, Message: "must be an integer greater than 0"}
+		}
+		resize.Set(name, v)
+	}
+	return nil
+}
+
+func (p *parser) parseRotation(s string) error {
+	rotate := imageserver.Params{}
+	if strings.HasPrefix(s, "!") {
+		s = strings.TrimPrefix(s, "!")
+		rotate.Set("flip", "horizontal")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || v > 360 {
+		return &imageserver.ParamError{Param: rotateParam + ".rotation", Message: "must be a number between 0 and 360"}
+	}
+	if v != 0 && v != 360 {
+		// IIIF rotation is clockwise, GIFT rotation is counter-clockwise.
+		rotate.Set("rotation", 360-v)
+	}
+	if !rotate.Empty() {
+		p.params.Set(rotateParam, rotate)
+	}
+	return nil
+}
+
+func (p *parser) parseQualityFormat(s string) error {
+	i := strings.LastIndex(s, ".")
+	if i < 0 {
+		return &imageserver.ParamError{Param: "format", Message: "missing"}
+	}
+	quality, format := s[:i], s[i+1:]
+	if quality != "default" && quality != "color" {
+		return &imageserver.ParamError{Param: "iiif_quality", Message: fmt.Sprintf("unsupported value \"%s\"", quality)}
+	}
+	switch format {
+	case "":
+		return &imageserver.ParamError{Param: "format", Message: "missing"}
+	case "jpg":
+		format = "jpeg"
+	case "tif":
+		format = "tiff"
+	}
+	p.params.Set("format", format)
+	return nil
+}
+
+// Resolve implements imageserver/http.Parser.
+//
+// It returns the name of the path segment.
+func (prs *Parser) Resolve(param string) string {
+	switch {
+	case param == imageserver.SourceParam:
+		return "identifier"
+	case param == pathParam:
+		return pathParam
+	case param == cropParam || strings.HasPrefix(param, cropParam+"."):
+		return "region"
+	case param == resizeParam || strings.HasPrefix(param, resizeParam+"."):
+		return "size"
+	case param == rotateParam || strings.HasPrefix(param, rotateParam+"."):
+		return "rotation"
+	case param == "iiif_quality":
+		return "quality"
+	case param == "format":
+		return "format"
+	}
+	return ""
+}
+
+func parseInts(s string, n int, param string) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, &imageserver.ParamError{Param: param, Message: fmt.Sprintf("expected %d comma separated integers", n)}
+	}
+	vs := make([]int, n)
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return nil, &imageserver.ParamError{Param: param, Message: fmt.Sprintf("invalid integer \"%s\"", part)}
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
+
+func parseFloats(s string, n int, param string) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, &imageserver.ParamError{Param: param, Message: fmt.Sprintf("expected %d comma separated numbers", n)}
+	}
+	vs := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return nil, &imageserver.ParamError{Param: param, Message: fmt.Sprintf("invalid number \"%s\"", part)}
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
+
+// pct returns the percentage v of n, rounded.
+func pct(v float64, n int) int {
+	return int(math.Floor(v*float64(n)/100 + 0.5))
+}
+
+func getSourceSize(ctx context.Context, srv imageserver.Server, source string) (image.Point, error) {
+	im, err := imageserver.GetWithContext(ctx, srv, imageserver.Params{imageserver.SourceParam: source})
+	if err != nil {
+		return image.ZP, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(im.Data))
+	if err != nil {
+		return image.ZP, &imageserver.ImageError{Message: fmt.Sprintf("decode config: %s", err)}
+	}
+	return image.Pt(cfg.Width, cfg.Height), nil
+}
@@ -0,0 +1,197 @@
+package iiif
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ imageserver_http.Parser = &Parser{}
+
+func TestParserParse(t *testing.T) {
+	type TC struct {
+		path               string
+		noServer           bool
+		expectedParams     imageserver.Params
+		expectedParamError string
+	}
+	for _, tc := range []TC{
+		{
+			path: "/medium.jpg/full/max/0/default.jpg",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "medium.jpg",
+				"format":                "jpeg",
+			},
+		},
+		{
+			path:     "/a%2Fb/c/10,20,100,200/150,/90/color.png",
+			noServer: true,
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "a/b/c",
+				cropParam: imageserver.Params{
+					"min_x": 10,
+					"min_y": 20,
+					"max_x": 110,
+					"max_y": 220,
+				},
+				resizeParam: imageserver.Params{"width": 150},
+				rotateParam: imageserver.Params{"rotation": 270.0},
+				"format":    "png",
+			},
+		},
+		{
+			path:     "/foo/full/,100/!0/default.jpg",
+			noServer: true,
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "foo",
+				resizeParam:             imageserver.Params{"height": 100},
+				rotateParam:             imageserver.Params{"flip": "horizontal"},
+				"format":                "jpeg",
+			},
+		},
+		{
+			path:     "/foo/full/%21300,200/!180/default.gif",
+			noServer: true,
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "foo",
+				resizeParam: imageserver.Params{
+					"width":  300,
+					"height": 200,
+					"mode":   "fit",
+				},
+				rotateParam: imageserver.Params{"flip": "horizontal", "rotation": 180.0},
+				"format":    "gif",
+			},
+		},
+		{
+			path:     "/foo/full/^300,200/0/default.jpg",
+			noServer: true,
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "foo",
+				resizeParam: imageserver.Params{
+					"width":  300,
+					"height": 200,
+				},
+				"format": "jpeg",
+			},
+		},
+		{
+			path: "/medium.jpg/square/max/0/default.jpg",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "medium.jpg",
+				cropParam: imageserver.Params{
+					"min_x": 102,
+					"min_y": 0,
+					"max_x": 921,
+					"max_y": 819,
+				},
+				"format": "jpeg",
+			},
+		},
+		{
+			path: "/medium.jpg/pct:50,50,50,50/pct:50/0/default.jpg",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "medium.jpg",
+				cropParam: imageserver.Params{
+					"min_x": 512,
+					"min_y": 410,
+					"max_x": 1024,
+					"max_y": 820,
+				},
+				resizeParam: imageserver.Params{
+					"width":  256,
+					"height": 205,
+				},
+				"format": "jpeg",
+			},
+		},
+		{
+			path: "/medium.jpg/full/pct:10/0/default.jpg",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "medium.jpg",
+				resizeParam: imageserver.Params{
+					"width":  102,
+					"height": 82,
+				},
+				"format": "jpeg",
+			},
+		},
+		{path: "/foo/full/max/default.jpg", expectedParamError: pathParam},
+		{path: "/foo/square/max/0/default.jpg", noServer: true, expectedParamError: cropParam},
+		{path: "/foo/full/pct:50/0/default.jpg", noServer: true, expectedParamError: resizeParam},
+		{path: "/foo/1,2,3/max/0/default.jpg", expectedParamError: cropParam},
+		{path: "/foo/1,2,0,4/max/0/default.jpg", expectedParamError: cropParam},
+		{path: "/foo/pct:a,b,c,d/max/0/default.jpg", expectedParamError: cropParam},
+		{path: "/foo/full/,/0/default.jpg", expectedParamError: resizeParam},
+		{path: "/foo/full/0,/0/default.jpg", expectedParamError: resizeParam + ".width"},
+		{path: "/foo/full/!100/0/default.jpg", expectedParamError: resizeParam},
+		{path: "/foo/full/pct:-1/0/default.jpg", expectedParamError: resizeParam},
+		{path: "/foo/full/max/400/default.jpg", expectedParamError: rotateParam + ".rotation"},
+		{path: "/foo/full/max/0/gray.jpg", expectedParamError: "iiif_quality"},
+		{path: "/foo/full/max/0/default", expectedParamError: "format"},
+		{path: "/foo/full/max/0/default.", expectedParamError: "format"},
+	} {
+		func() {
+			defer func() {
+				if t.Failed() {
+					t.Logf("%#v", tc)
+				}
+			}()
+			req, err := http.NewRequest("GET", "http://localhost"+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prs := &Parser{}
+			if !tc.noServer {
+				prs.Server = testdata.Server
+			}
+			params := imageserver.Params{}
+			err = prs.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if params.String() != tc.expectedParams.String() {
+				t.Fatalf("unexpected params: got %s, want %s", params, tc.expectedParams)
+			}
+		}()
+	}
+}
+
+func TestParserParseErrorSourceNotFound(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://localhost/unknown/square/max/0/default.jpg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prs := &Parser{Server: testdata.Server}
+	err = prs.Parse(req, imageserver.Params{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func TestParserResolve(t *testing.T) {
+	prs := &Parser{}
+	for param, expected := range map[string]string{
+		imageserver.SourceParam:   "identifier",
+		pathParam:                 "path",
+		cropParam:                 "region",
+		resizeParam + ".width":    "size",
+		rotateParam + ".rotation": "rotation",
+		"iiif_quality":            "quality",
+		"format":                  "format",
+		"foo":                     "",
+	} {
+		if httpParam := prs.Resolve(param); httpParam != expected {
+			t.Fatalf("unexpected result for \"%s\": got \"%s\", want \"%s\"", param, httpParam, expected)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package iiif
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+const infoSuffix = "/info.json"
+
+// Info is the image information document ("info.json") of the IIIF Image API 3.0.
+type Info struct {
+	Context       string   `json:"@context"`
+	ID            string   `json:"id"`
+	Type          string   `json:"type"`
+	Protocol      string   `json:"protocol"`
+	Profile       string   `json:"profile"`
+	Width         int      `json:"width"`
+	Height        int      `json:"height"`
+	ExtraFormats  []string `json:"extraFormats,omitempty"`
+	ExtraFeatures []string `json:"extraFeatures,omitempty"`
+}
+
+// InfoHandler is a net/http.Handler implementation that serves the "info.json" document of the IIIF Image API 3.0.
+//
+// The HTTP URL path must have the following format: /{identifier}/info.json .
+// The dimensions come from the source Image returned by Server.
+//
+// Other requests are forwarded to Handler (e.g. a imageserver/http.Handler with Parser).
+//
+// Errors are handled like imageserver/http.Handler.
+type InfoHandler struct {
+	// Handler is an optional net/http.Handler that handles the other requests.
+	// If it is nil, they return a StatusNotFound/404 response.
+	Handler http.Handler
+
+	// Server is a imageserver.Server that returns the source Image (only the "source" param is given).
+	Server imageserver.Server
+
+	// BaseURL is an optional base URL used to build the "id" field, e.g. "https://example.com/iiif".
+	// By default, it is built from the HTTP request.
+	BaseURL string
+
+	// ErrorFunc is an optional function that is called if there is an internal error.
+	ErrorFunc func(err error, req *http.Request)
+}
+
+// ServeHTTP implements net/http.Handler.
+func (h *InfoHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !strings.HasSuffix(req.URL.Path, infoSuffix) {
+		if h.Handler != nil {
+			h.Handler.ServeHTTP(rw, req)
+		} else {
+			http.NotFound(rw, req)
+		}
+		return
+	}
+	err := h.serveHTTP(rw, req)
+	if err != nil {
+		imageserver_http.SendError(rw, req, err, &Parser{}, h.ErrorFunc)
+	}
+}
+
+func (h *InfoHandler) serveHTTP(rw http.ResponseWriter, req *http.Request) error {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return imageserver_http.NewErrorDefaultText(http.StatusMethodNotAllowed)
+	}
+	escapedID := strings.TrimPrefix(strings.TrimSuffix(req.URL.EscapedPath(), infoSuffix), "/")
+	source, err := unescapeIdentifier(escapedID)
+	if err != nil {
+		return err
+	}
+	size, err := getSourceSize(req.Context(), h.Server, source)
+	if err != nil {
+		return err
+	}
+	info := &Info{
+		Context:  "http://iiif.io/api/image/3/context.json",
+		ID:       h.getID(req),
+		Type:     "ImageService3",
+		Protocol: "http://iiif.io/api/image",
+		Profile:  "level1",
+		Width:    size.X,
+		Height:   size.Y,
+		ExtraFormats: []string{
+			"gif",
+		},
+		ExtraFeatures: []string{
+			"mirroring",
+			"regionByPct",
+			"regionSquare",
+			"rotationArbitrary",
+			"rotationBy90s",
+			"sizeByConfinedWh",
+			"sizeByPct",
+			"sizeByWh",
+			"sizeUpscaling",
+		},
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", "application/ld+json;profile=\"http://iiif.io/api/image/3/context.json\"")
+	rw.Header().Set("Access-Control-Allow-Origin", "*")
+	if req.Method == "GET" {
+		rw.Write(data)
+	}
+	return nil
+}
+
+// getID returns the base URI of the image: the URL without "/info.json".
+func (h *InfoHandler) getID(req *http.Request) string {
+	if h.BaseURL != "" {
+		id := strings.TrimSuffix(req.URL.EscapedPath(), infoSuffix)
+		return strings.TrimSuffix(h.BaseURL, "/") + "/" + strings.TrimPrefix(id, "/")
+	}
+	p := req.URL.EscapedPath()
+	// req.RequestURI contains the original path, even behind net/http.StripPrefix.
+	if u, err := url.ParseRequestURI(req.RequestURI); err == nil && u.Path != "" {
+		p = u.EscapedPath()
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + strings.TrimSuffix(p, infoSuffix)
+}
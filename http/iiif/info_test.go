@@ -0,0 +1,114 @@
+package iiif
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ http.Handler = &InfoHandler{}
+
+func TestInfoHandler(t *testing.T) {
+	for _, tc := range []struct {
+		handler    *InfoHandler
+		url        string
+		expectedID string
+	}{
+		{
+			handler:    &InfoHandler{Server: testdata.Server},
+			url:        "http://localhost/medium.jpg/info.json",
+			expectedID: "http://localhost/medium.jpg",
+		},
+		{
+			handler:    &InfoHandler{Server: testdata.Server, BaseURL: "https://example.com/iiif/"},
+			url:        "http://localhost/medium.jpg/info.json",
+			expectedID: "https://example.com/iiif/medium.jpg",
+		},
+	} {
+		req, err := http.NewRequest("GET", tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected http status: %d", w.Code)
+		}
+		info := new(Info)
+		err = json.Unmarshal(w.Body.Bytes(), info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ID != tc.expectedID {
+			t.Fatalf("unexpected id: got \"%s\", want \"%s\"", info.ID, tc.expectedID)
+		}
+		if info.Width != 1024 || info.Height != 819 {
+			t.Fatalf("unexpected size: got %dx%d, want 1024x819", info.Width, info.Height)
+		}
+		if info.Type != "ImageService3" {
+			t.Fatalf("unexpected type: %s", info.Type)
+		}
+	}
+}
+
+func TestInfoHandlerStripPrefix(t *testing.T) {
+	h := http.StripPrefix("/iiif", &InfoHandler{Server: testdata.Server})
+	req := httptest.NewRequest("GET", "http://localhost/iiif/medium.jpg/info.json", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+	info := new(Info)
+	err := json.Unmarshal(w.Body.Bytes(), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "http://localhost/iiif/medium.jpg"; info.ID != expected {
+		t.Fatalf("unexpected id: got \"%s\", want \"%s\"", info.ID, expected)
+	}
+}
+
+func TestInfoHandlerOther(t *testing.T) {
+	called := false
+	h := &InfoHandler{
+		Server: testdata.Server,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}),
+	}
+	req := httptest.NewRequest("GET", "http://localhost/medium.jpg/full/max/0/default.jpg", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !called {
+		t.Fatal("not called")
+	}
+	h.Handler = nil
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected http status: %d", w.Code)
+	}
+}
+
+func TestInfoHandlerError(t *testing.T) {
+	for _, tc := range []struct {
+		method       string
+		url          string
+		expectedCode int
+	}{
+		{"POST", "http://localhost/medium.jpg/info.json", http.StatusMethodNotAllowed},
+		{"GET", "http://localhost/info.json", http.StatusBadRequest},
+		{"GET", "http://localhost/unknown/info.json", http.StatusBadRequest},
+		{"GET", "http://localhost/invalid.jpg/info.json", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		w := httptest.NewRecorder()
+		(&InfoHandler{Server: testdata.Server}).ServeHTTP(w, req)
+		if w.Code != tc.expectedCode {
+			t.Fatalf("unexpected http status for %s %s: got %d, want %d", tc.method, tc.url, w.Code, tc.expectedCode)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package image
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_image "github.com/pierrre/imageserver/image"
+)
+
+// DefaultAcceptFormats is the default preference order of AcceptFormatParser.
+//
+// It contains only lossy formats, so photos are not re-encoded to a larger lossless format (e.g. PNG).
+var DefaultAcceptFormats = []string{"webp", "avif", "jpeg"}
+
+// AcceptFormatParser is a imageserver/http.Parser implementation for imageserver/image.
+//
+// It negotiates the "format" param with the "Accept" header of the HTTP request.
+// Only the formats with a registered Encoder (see imageserver/image.RegisterEncoder) are used.
+//
+// A format is selected only if its media type ("image/{format}") is explicitly listed in the "Accept" header with a q-value greater than 0,
+// because the wildcards ("image/*", "*/*") are also sent by clients that don't support the modern formats.
+// The format with the highest q-value is selected, and Formats breaks ties.
+// Its q-value must be greater than or equal to the q-value of "image/*" (or "*/*" if it is not listed), the explicitly listed type wins a tie.
+// It must be strictly greater than the q-value of the source format, if "image/{source format}" is explicitly listed.
+// The source format is guessed from the extension of the "source" param (e.g. "photo.jpg").
+// If no format is acceptable, or if it is the source format, the "format" param is not set (the source format is kept).
+//
+// It doesn't change an existing "format" param, so it can be used after FormatParser to allow an explicit format.
+//
+// It implements imageserver/http.VaryParser, so Handler adds "Accept" to the "Vary" header.
+type AcceptFormatParser struct {
+	// Formats is an optional preference order.
+	// DefaultAcceptFormats is used by default.
+	Formats []string
+}
+
+// Parse implements imageserver/http.Parser.
+func (parser *AcceptFormatParser) Parse(req *http.Request, params imageserver.Params) error {
+	if params.Has("format") {
+		return nil
+	}
+	accept := parseAccept(req.Header.Get("Accept"))
+	if len(accept) == 0 {
+		return nil
+	}
+	formats := parser.Formats
+	if formats == nil {
+		formats = DefaultAcceptFormats
+	}
+	srcFormat := getSourceFormat(params)
+	srcQ, srcListed := accept["image/"+srcFormat]
+	wildcardQ := getAcceptWildcardQ(accept)
+	best := ""
+	bestQ := 0.0
+	for _, format := range formats {
+		q, ok := accept["image/"+format]
+		if !ok || q <= 0 || q < wildcardQ || q <= bestQ || !imageserver_image.HasEncoder(format) {
+			continue
+		}
+		if srcFormat != "" && srcListed && format != srcFormat && q <= srcQ {
+			continue
+		}
+		best = format
+		bestQ = q
+	}
+	if best != "" && best != srcFormat {
+		params.Set("format", best)
+	}
+	return nil
+}
+
+// getAcceptWildcardQ returns the q-value of "image/*", or "*/*" if it is not listed.
+func getAcceptWildcardQ(accept map[string]float64) float64 {
+	if q, ok := accept["image/*"]; ok {
+		return q
+	}
+	return accept["*/*"]
+}
+
+var sourceExtensionFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+	".webp": "webp",
+	".avif": "avif",
+}
+
+// getSourceFormat guesses the source format from the extension of the "source" param.
+//
+// It returns an empty string if it is unknown.
+func getSourceFormat(params imageserver.Params) string {
+	source, err := params.GetString(imageserver.SourceParam)
+	if err != nil {
+		return ""
+	}
+	if i := strings.IndexAny(source, "?#"); i >= 0 {
+		source = source[:i]
+	}
+	return sourceExtensionFormats[strings.ToLower(path.Ext(source))]
+}
+
+// Resolve implements imageserver/http.Parser.
+func (parser *AcceptFormatParser) Resolve(param string) string {
+	if param == "format" {
+		return "Accept"
+	}
+	return ""
+}
+
+// Vary implements imageserver/http.VaryParser.
+func (parser *AcceptFormatParser) Vary() []string {
+	return []string{"Accept"}
+}
+
+// parseAccept parses the "Accept" header, and returns the q-value of each media type.
+//
+// If a media type is listed several times, the highest q-value is kept.
+func parseAccept(header string) map[string]float64 {
+	res := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if !strings.HasPrefix(field, "q=") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimPrefix(field, "q="), 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			q = v
+		}
+		if old, ok := res[mediaType]; !ok || q > old {
+			res[mediaType] = q
+		}
+	}
+	return res
+}
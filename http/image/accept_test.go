@@ -0,0 +1,154 @@
+package image
+
+import (
+	"image"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	_ "github.com/pierrre/imageserver/image/jpeg"
+	_ "github.com/pierrre/imageserver/image/png"
+)
+
+var _ imageserver_http.Parser = &AcceptFormatParser{}
+
+var _ imageserver_http.VaryParser = &AcceptFormatParser{}
+
+func init() {
+	// There is no WebP encoder in this repository, a fake one is registered to test the real browser "Accept" headers.
+	imageserver_image.RegisterEncoder("webp", imageserver_image.EncoderFunc(func(w io.Writer, nim image.Image, params imageserver.Params) error {
+		return nil
+	}))
+}
+
+func TestAcceptFormatParserParse(t *testing.T) {
+	type TC struct {
+		accept         string
+		formats        []string
+		params         imageserver.Params
+		expectedFormat string
+	}
+	for _, tc := range []TC{
+		{accept: "", expectedFormat: ""},
+		{accept: "*/*", expectedFormat: ""},
+		{accept: "image/*,*/*;q=0.8", expectedFormat: ""},
+		{accept: "image/jpeg", expectedFormat: "jpeg"},
+		{accept: "image/png", expectedFormat: ""},
+		{accept: "image/jpeg,image/png", expectedFormat: "jpeg"},
+		{accept: "image/jpeg,image/png", formats: []string{"png", "jpeg"}, expectedFormat: "png"},
+		{accept: "image/jpeg,image/png;q=0.5", formats: []string{"png", "jpeg"}, expectedFormat: "jpeg"},
+		{accept: "image/jpeg;q=0.5, IMAGE/PNG ; q=0.8", formats: []string{"jpeg", "png"}, expectedFormat: "png"},
+		{accept: "image/png;q=0,image/jpeg;q=0.1", formats: []string{"png", "jpeg"}, expectedFormat: "jpeg"},
+		{accept: "image/png;q=0", formats: []string{"png"}, expectedFormat: ""},
+		{accept: "image/png;q=invalid", formats: []string{"png"}, expectedFormat: ""},
+		// browsers
+		{
+			// Chrome
+			accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+			params:         imageserver.Params{imageserver.SourceParam: "photo.jpg"},
+			expectedFormat: "webp",
+		},
+		{
+			// Chrome (image)
+			accept:         "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8",
+			params:         imageserver.Params{imageserver.SourceParam: "photo.jpg"},
+			expectedFormat: "webp",
+		},
+		{
+			// Firefox (image)
+			accept:         "image/avif,image/webp,*/*",
+			params:         imageserver.Params{imageserver.SourceParam: "photo.jpg"},
+			expectedFormat: "webp",
+		},
+		{
+			// Safari (image)
+			accept:         "image/webp,image/avif,image/jxl,image/heic,image/heic-sequence,video/*;q=0.8,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5",
+			params:         imageserver.Params{imageserver.SourceParam: "photo.jpg"},
+			expectedFormat: "webp",
+		},
+		{
+			// old Firefox (image), without WebP support
+			accept:         "image/png,image/*;q=0.8,*/*;q=0.5",
+			params:         imageserver.Params{imageserver.SourceParam: "photo.jpg"},
+			expectedFormat: "",
+		},
+		{
+			// Chrome (image), same format
+			accept:         "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8",
+			params:         imageserver.Params{imageserver.SourceParam: "photo.webp"},
+			expectedFormat: "",
+		},
+		// ranked against the wildcard
+		{accept: "image/jpeg;q=0.8,image/*", expectedFormat: ""},
+		{accept: "image/jpeg;q=0.8,*/*;q=0.9", expectedFormat: ""},
+		{accept: "image/jpeg,image/*", expectedFormat: "jpeg"},
+		{accept: "image/jpeg,*/*;q=0.9", expectedFormat: "jpeg"},
+		// ranked above the explicit source format
+		{accept: "image/png,image/jpeg;q=0.9", formats: []string{"png"}, params: imageserver.Params{imageserver.SourceParam: "/foo/photo.JPG?v=1"}, expectedFormat: "png"},
+		{accept: "image/png;q=0.9,image/jpeg", formats: []string{"png"}, params: imageserver.Params{imageserver.SourceParam: "photo.jpg"}, expectedFormat: ""},
+		{accept: "image/png,image/jpeg", formats: []string{"png"}, params: imageserver.Params{imageserver.SourceParam: "photo.jpg"}, expectedFormat: ""},
+		{accept: "image/jpeg", params: imageserver.Params{imageserver.SourceParam: "photo.jpg"}, expectedFormat: ""},
+		// not registered
+		{accept: "image/avif", expectedFormat: ""},
+		{accept: "image/avif,image/jpeg;q=0.9", expectedFormat: "jpeg"},
+		// explicit format
+		{accept: "image/png", params: imageserver.Params{"format": "gif"}, expectedFormat: "gif"},
+	} {
+		func() {
+			defer func() {
+				if t.Failed() {
+					t.Logf("%#v", tc)
+				}
+			}()
+			req, err := http.NewRequest("GET", "http://localhost", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			params := tc.params
+			if params == nil {
+				params = imageserver.Params{}
+			}
+			parser := &AcceptFormatParser{Formats: tc.formats}
+			err = parser.Parse(req, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format := ""
+			if params.Has("format") {
+				format, err = params.GetString("format")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if format != tc.expectedFormat {
+				t.Fatalf("unexpected format: got \"%s\", want \"%s\"", format, tc.expectedFormat)
+			}
+		}()
+	}
+}
+
+func TestAcceptFormatParserResolve(t *testing.T) {
+	parser := &AcceptFormatParser{}
+	if parser.Resolve("format") != "Accept" {
+		t.Fatal("not equals")
+	}
+	if parser.Resolve("foo") != "" {
+		t.Fatal("not equals")
+	}
+}
+
+func TestAcceptFormatParserVary(t *testing.T) {
+	vary := imageserver_http.GetVary(imageserver_http.ListParser{
+		&FormatParser{},
+		&AcceptFormatParser{},
+	})
+	if len(vary) != 1 || vary[0] != "Accept" {
+		t.Fatalf("unexpected vary: %v", vary)
+	}
+}
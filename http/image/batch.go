@@ -0,0 +1,254 @@
+package image
+
+import (
+	"archive/zip"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	imageserver_image "github.com/pierrre/imageserver/image"
+)
+
+const (
+	// BatchVariantParam is the HTTP query param that contains a variant.
+	BatchVariantParam = "variant"
+	// BatchOutputParam is the HTTP query param that selects the output ("multipart" or "zip").
+	BatchOutputParam = "output"
+
+	// DefaultBatchMaxVariants is the default maximum number of variants.
+	DefaultBatchMaxVariants = 16
+)
+
+// BatchHandler is a net/http.Handler implementation that returns several variants of the same Image.
+//
+// The source Image is fetched once from Server, and the variants are processed by Handler (the Image is decoded once).
+//
+// Each "variant" HTTP query param is an encoded query string, that is merged with the other HTTP query params (it overrides them).
+// The Params of each variant are parsed by Parser.
+// All variants must have the same source.
+// Example: "/batch?source=image.jpg&format=jpeg&variant=width%3D100&variant=width%3D200%26quality%3D50"
+//
+// The "output" HTTP query param selects the response format:
+//  - "multipart" (default): a "multipart/mixed" response, with a part for each variant, in the same order
+//  - "zip": a ZIP archive, with a file "variant-N.FORMAT" for each variant
+//
+// If a variant fails, its part is "text/plain", with a "Status" header (e.g. "400 Bad Request"),
+// and the ZIP file is "variant-N.error.txt".
+// The other variants are not affected.
+//
+// Supported methods are: GET.
+// Errors (for the whole request) are handled like imageserver/http.Handler.
+type BatchHandler struct {
+	// Parser parses the HTTP request and fills the Params.
+	Parser imageserver_http.Parser
+
+	// Server returns the source Image.
+	// It receives only the "source" param.
+	Server imageserver.Server
+
+	// Handler processes the variants.
+	// It limits the number of concurrent executions.
+	Handler *imageserver_image.BatchHandler
+
+	// MaxVariants is the maximum number of variants.
+	// Default: DefaultBatchMaxVariants.
+	MaxVariants int
+
+	// ErrorFunc is an optional function that is called if there is an internal error.
+	ErrorFunc func(err error, req *http.Request)
+}
+
+// ServeHTTP implements net/http.Handler.
+func (handler *BatchHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	err := handler.serveHTTP(rw, req)
+	if err != nil {
+		imageserver_http.SendError(rw, req, err, handler.Parser, handler.ErrorFunc)
+	}
+}
+
+func (handler *BatchHandler) serveHTTP(rw http.ResponseWriter, req *http.Request) error {
+	if req.Method != "GET" {
+		return imageserver_http.NewErrorDefaultText(http.StatusMethodNotAllowed)
+	}
+	query := req.URL.Query()
+	output := query.Get(BatchOutputParam)
+	if output == "" {
+		output = "multipart"
+	}
+	if output != "multipart" && output != "zip" {
+		return &imageserver.ParamError{Param: BatchOutputParam, Message: "invalid value"}
+	}
+	variants := query[BatchVariantParam]
+	if len(variants) == 0 {
+		return &imageserver.ParamError{Param: BatchVariantParam, Message: "missing"}
+	}
+	if len(variants) > handler.getMaxVariants() {
+		return &imageserver.ParamError{Param: BatchVariantParam, Message: fmt.Sprintf("too many values (max %d)", handler.getMaxVariants())}
+	}
+	query.Del(BatchVariantParam)
+	query.Del(BatchOutputParam)
+	params, err := handler.parse(req, query)
+	if err != nil {
+		return err
+	}
+	source, err := params.GetString(imageserver.SourceParam)
+	if err != nil {
+		return err
+	}
+	paramsList := make([]imageserver.Params, len(variants))
+	errs := make([]error, len(variants))
+	for i, variant := range variants {
+		paramsList[i], errs[i] = handler.parseVariant(req, query, variant, source)
+	}
+	im, err := imageserver.GetWithContext(req.Context(), handler.Server, imageserver.Params{imageserver.SourceParam: source})
+	if err != nil {
+		return err
+	}
+	results := handler.handle(req, im, paramsList, errs)
+	if output == "zip" {
+		return handler.sendZip(rw, req, results)
+	}
+	return handler.sendMultipart(rw, req, results)
+}
+
+func (handler *BatchHandler) getMaxVariants() int {
+	if handler.MaxVariants > 0 {
+		return handler.MaxVariants
+	}
+	return DefaultBatchMaxVariants
+}
+
+func (handler *BatchHandler) parse(req *http.Request, query url.Values) (imageserver.Params, error) {
+	r := new(http.Request)
+	*r = *req
+	u := new(url.URL)
+	*u = *req.URL
+	u.RawQuery = query.Encode()
+	r.URL = u
+	params := imageserver.Params{}
+	err := handler.Parser.Parse(r, params)
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func (handler *BatchHandler) parseVariant(req *http.Request, query url.Values, variant string, source string) (imageserver.Params, error) {
+	variantQuery, err := url.ParseQuery(variant)
+	if err != nil {
+		return nil, &imageserver.ParamError{Param: BatchVariantParam, Message: err.Error()}
+	}
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	for k, v := range variantQuery {
+		q[k] = v
+	}
+	params, err := handler.parse(req, q)
+	if err != nil {
+		return nil, err
+	}
+	s, err := params.GetString(imageserver.SourceParam)
+	if err != nil {
+		return nil, err
+	}
+	if s != source {
+		return nil, &imageserver.ParamError{Param: imageserver.SourceParam, Message: "must be the same for all variants"}
+	}
+	return params, nil
+}
+
+func (handler *BatchHandler) handle(req *http.Request, im *imageserver.Image, paramsList []imageserver.Params, errs []error) []*imageserver_image.BatchResult {
+	var valid []imageserver.Params
+	for i, params := range paramsList {
+		if errs[i] == nil {
+			valid = append(valid, params)
+		}
+	}
+	validResults := handler.Handler.HandleBatch(req.Context(), im, valid)
+	results := make([]*imageserver_image.BatchResult, len(paramsList))
+	for i := range paramsList {
+		if errs[i] != nil {
+			results[i] = &imageserver_image.BatchResult{Err: errs[i]}
+			continue
+		}
+		results[i] = validResults[0]
+		validResults = validResults[1:]
+	}
+	return results
+}
+
+func (handler *BatchHandler) sendMultipart(rw http.ResponseWriter, req *http.Request, results []*imageserver_image.BatchResult) error {
+	mw := multipart.NewWriter(rw)
+	rw.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	rw.WriteHeader(http.StatusOK)
+	for i, res := range results {
+		h := textproto.MIMEHeader{}
+		var data []byte
+		if res.Err != nil {
+			httpErr := imageserver_http.ConvertError(res.Err, req, handler.Parser, handler.ErrorFunc)
+			h.Set("Content-Type", "text/plain; charset=utf-8")
+			h.Set("Status", fmt.Sprintf("%d %s", httpErr.Code, http.StatusText(httpErr.Code)))
+			data = []byte(httpErr.Text)
+		} else {
+			h.Set("Content-Type", "image/"+res.Image.Format)
+			h.Set("Content-Length", strconv.Itoa(len(res.Image.Data)))
+			data = res.Image.Data
+		}
+		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", getBatchFileName(i, res)))
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return nil // The response is already started, and the client is probably gone.
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			return nil
+		}
+	}
+	mw.Close()
+	return nil
+}
+
+func (handler *BatchHandler) sendZip(rw http.ResponseWriter, req *http.Request, results []*imageserver_image.BatchResult) error {
+	rw.Header().Set("Content-Type", "application/zip")
+	rw.WriteHeader(http.StatusOK)
+	zw := zip.NewWriter(rw)
+	for i, res := range results {
+		var data []byte
+		fh := &zip.FileHeader{
+			Name: getBatchFileName(i, res),
+		}
+		if res.Err != nil {
+			httpErr := imageserver_http.ConvertError(res.Err, req, handler.Parser, handler.ErrorFunc)
+			fh.Method = zip.Deflate
+			data = []byte(fmt.Sprintf("%d %s: %s", httpErr.Code, http.StatusText(httpErr.Code), httpErr.Text))
+		} else {
+			// Images are already compressed.
+			fh.Method = zip.Store
+			data = res.Image.Data
+		}
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			return nil // The response is already started, and the client is probably gone.
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			return nil
+		}
+	}
+	zw.Close()
+	return nil
+}
+
+func getBatchFileName(i int, res *imageserver_image.BatchResult) string {
+	if res.Err != nil {
+		return fmt.Sprintf("variant-%d.error.txt", i)
+	}
+	return fmt.Sprintf("variant-%d.%s", i, res.Image.Format)
+}
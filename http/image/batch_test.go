@@ -0,0 +1,154 @@
+package image
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ http.Handler = &BatchHandler{}
+
+func newTestBatchHandler() *BatchHandler {
+	return &BatchHandler{
+		Parser: imageserver_http.ListParser{
+			&imageserver_http.SourceParser{},
+			&FormatParser{},
+			&QualityParser{},
+		},
+		Server:  testdata.Server,
+		Handler: imageserver_image.NewBatchHandler(nil, 2),
+	}
+}
+
+func newTestBatchURL(output string, variants ...string) string {
+	q := url.Values{}
+	q.Set("source", testdata.MediumFileName)
+	q.Set("format", "jpeg")
+	if output != "" {
+		q.Set(BatchOutputParam, output)
+	}
+	q[BatchVariantParam] = variants
+	return "http://localhost?" + q.Encode()
+}
+
+func TestBatchHandlerMultipart(t *testing.T) {
+	h := newTestBatchHandler()
+	req := httptest.NewRequest("GET", newTestBatchURL("", "quality=50", "quality=90", "quality=9001", "source=small.jpg"), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+	mediaType, mediaParams, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("unexpected media type: %s", mediaType)
+	}
+	mr := multipart.NewReader(w.Body, mediaParams["boundary"])
+	var parts [][]byte
+	for i := 0; ; i++ {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		data, err := ioutil.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, data)
+		expectedType, expectedStatus := "image/jpeg", ""
+		if i >= 2 {
+			expectedType, expectedStatus = "text/plain; charset=utf-8", "400 Bad Request"
+		}
+		if v := p.Header.Get("Content-Type"); v != expectedType {
+			t.Fatalf("unexpected Content-Type for part %d: %s", i, v)
+		}
+		if v := p.Header.Get("Status"); v != expectedStatus {
+			t.Fatalf("unexpected Status for part %d: %s", i, v)
+		}
+	}
+	if len(parts) != 4 {
+		t.Fatalf("unexpected parts count: %d", len(parts))
+	}
+	if bytes.Equal(parts[0], parts[1]) {
+		t.Fatal("variants are equal")
+	}
+}
+
+func TestBatchHandlerZip(t *testing.T) {
+	h := newTestBatchHandler()
+	req := httptest.NewRequest("GET", newTestBatchURL("zip", "quality=50", "quality=9001"), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+	if v := w.Header().Get("Content-Type"); v != "application/zip" {
+		t.Fatalf("unexpected Content-Type: %s", v)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("unexpected files count: %d", len(zr.File))
+	}
+	for i, name := range []string{"variant-0.jpeg", "variant-1.error.txt"} {
+		if zr.File[i].Name != name {
+			t.Fatalf("unexpected file name: %s", zr.File[i].Name)
+		}
+	}
+}
+
+func TestBatchHandlerError(t *testing.T) {
+	for _, tc := range []struct {
+		method       string
+		url          string
+		expectedCode int
+	}{
+		{"POST", newTestBatchURL("", "quality=50"), http.StatusMethodNotAllowed},
+		{"GET", newTestBatchURL("tar", "quality=50"), http.StatusBadRequest},
+		{"GET", newTestBatchURL(""), http.StatusBadRequest},
+		{"GET", newTestBatchURL("", "1", "2", "3"), http.StatusBadRequest},
+		{"GET", "http://localhost?variant=quality%3D50", http.StatusBadRequest},
+		{"GET", "http://localhost?source=unknown&variant=quality%3D50", http.StatusBadRequest},
+	} {
+		h := newTestBatchHandler()
+		h.MaxVariants = 2
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.expectedCode {
+			t.Fatalf("unexpected http status for %s %s: got %d, want %d", tc.method, tc.url, w.Code, tc.expectedCode)
+		}
+	}
+}
+
+func TestBatchHandlerServerParams(t *testing.T) {
+	h := newTestBatchHandler()
+	h.Server = imageserver.ServerFunc(func(params imageserver.Params) (*imageserver.Image, error) {
+		if params.Len() != 1 {
+			t.Fatalf("unexpected params: %s", params)
+		}
+		return testdata.Server.Get(params)
+	})
+	req := httptest.NewRequest("GET", newTestBatchURL("", "quality=50"), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+}
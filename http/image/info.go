@@ -0,0 +1,67 @@
+package image
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	imageserver_image "github.com/pierrre/imageserver/image"
+)
+
+// InfoHandler is a net/http.Handler implementation that returns the info of an Image as JSON.
+//
+// Server must return the info of the Image (see imageserver/image.InfoServer).
+// It can be cached with imageserver/cache.Server.
+// The Params are parsed by Parser, so the info describes the processed Image
+// (e.g. imageserver/image.InfoServer wrapping the same Server as the imageserver/http.Handler).
+//
+// Supported methods are: GET and HEAD.
+// Errors are handled like imageserver/http.Handler.
+type InfoHandler struct {
+	// Parser parses the HTTP request and fills the Params.
+	Parser imageserver_http.Parser
+
+	// Server returns the info.
+	Server imageserver.Server
+
+	// ErrorFunc is an optional function that is called if there is an internal error.
+	ErrorFunc func(err error, req *http.Request)
+}
+
+// ServeHTTP implements net/http.Handler.
+func (handler *InfoHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	err := handler.serveHTTP(rw, req)
+	if err != nil {
+		imageserver_http.SendError(rw, req, err, handler.Parser, handler.ErrorFunc)
+	}
+}
+
+func (handler *InfoHandler) serveHTTP(rw http.ResponseWriter, req *http.Request) error {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return imageserver_http.NewErrorDefaultText(http.StatusMethodNotAllowed)
+	}
+	params := imageserver.Params{}
+	err := handler.Parser.Parse(req, params)
+	if err != nil {
+		return err
+	}
+	if vary := imageserver_http.GetVary(handler.Parser); len(vary) > 0 {
+		rw.Header().Set("Vary", strings.Join(vary, ", "))
+	}
+	im, err := imageserver.GetWithContext(req.Context(), handler.Server, params)
+	if err != nil {
+		return err
+	}
+	if im.Format != imageserver_image.InfoFormat {
+		return fmt.Errorf("unexpected info format \"%s\"", im.Format)
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(im.Data)))
+	if req.Method == "GET" {
+		rw.Write(im.Data)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+	imageserver_image "github.com/pierrre/imageserver/image"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ http.Handler = &InfoHandler{}
+
+func TestInfoHandler(t *testing.T) {
+	h := &InfoHandler{
+		Parser: &imageserver_http.SourceParser{},
+		Server: &imageserver_image.InfoServer{Server: testdata.Server},
+	}
+	req := httptest.NewRequest("GET", "http://localhost?source=medium.jpg", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+	if v := w.Header().Get("Content-Type"); v != "application/json" {
+		t.Fatalf("unexpected Content-Type: %s", v)
+	}
+	info := new(imageserver_image.Info)
+	err := json.Unmarshal(w.Body.Bytes(), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "jpeg" || info.Width != 1024 || info.Height != 819 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+}
+
+func TestInfoHandlerError(t *testing.T) {
+	errorFuncCalled := false
+	for _, tc := range []struct {
+		method       string
+		url          string
+		server       imageserver.Server
+		expectedCode int
+	}{
+		{"POST", "http://localhost?source=medium.jpg", nil, http.StatusMethodNotAllowed},
+		{"GET", "http://localhost?source=invalid.jpg", nil, http.StatusBadRequest},
+		{"GET", "http://localhost?source=medium.jpg", testdata.Server, http.StatusInternalServerError},
+	} {
+		srv := tc.server
+		if srv == nil {
+			srv = &imageserver_image.InfoServer{Server: testdata.Server}
+		}
+		h := &InfoHandler{
+			Parser: &imageserver_http.SourceParser{},
+			Server: srv,
+			ErrorFunc: func(err error, req *http.Request) {
+				errorFuncCalled = true
+			},
+		}
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.expectedCode {
+			t.Fatalf("unexpected http status for %s %s: got %d, want %d", tc.method, tc.url, w.Code, tc.expectedCode)
+		}
+	}
+	if !errorFuncCalled {
+		t.Fatal("error func not called")
+	}
+}
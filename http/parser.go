@@ -49,6 +49,67 @@ func (lp ListParser) Resolve(param string) string {
 	return ""
 }
 
+// Vary implements VaryParser.
+//
+// It returns the headers of all sub parsers.
+func (lp ListParser) Vary() []string {
+	var headers []string
+	for _, subParser := range lp {
+		headers = appendVary(headers, GetVary(subParser)...)
+	}
+	return headers
+}
+
+// SetResponseHeader implements ResponseHeaderParser.
+//
+// It calls all sub parsers that implement ResponseHeaderParser.
+func (lp ListParser) SetResponseHeader(header http.Header, params imageserver.Params) {
+	for _, subParser := range lp {
+		if hp, ok := subParser.(ResponseHeaderParser); ok {
+			hp.SetResponseHeader(header, params)
+		}
+	}
+}
+
+// VaryParser is a Parser that uses HTTP request headers.
+//
+// Handler adds these headers to the "Vary" response header, so caches store a variant for each value.
+type VaryParser interface {
+	Vary() []string
+}
+
+// GetVary returns the headers used by the Parser if it implements VaryParser, or nil otherwise.
+func GetVary(parser Parser) []string {
+	if vp, ok := parser.(VaryParser); ok {
+		return vp.Vary()
+	}
+	return nil
+}
+
+// ResponseHeaderParser is a Parser that sets HTTP response headers.
+//
+// Handler calls SetResponseHeader with the parsed Params, before sending the response.
+type ResponseHeaderParser interface {
+	SetResponseHeader(http.Header, imageserver.Params)
+}
+
+// appendVary appends the headers that are not already in the list.
+func appendVary(headers []string, newHeaders ...string) []string {
+	for _, h := range newHeaders {
+		found := false
+		for _, existing := range headers {
+			if http.CanonicalHeaderKey(existing) == http.CanonicalHeaderKey(h) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
 // SourceParser is a Parser implementation that takes the "source" param from the HTTP URL query.
 type SourceParser struct{}
 
@@ -96,6 +157,18 @@ func (ps *SourceTransformParser) Parse(req *http.Request, params imageserver.Par
 	return parseSourceTransform(ps.Parser, req, params, ps.Transform)
 }
 
+// Vary implements VaryParser.
+func (ps *SourceTransformParser) Vary() []string {
+	return GetVary(ps.Parser)
+}
+
+// SetResponseHeader implements ResponseHeaderParser.
+func (ps *SourceTransformParser) SetResponseHeader(header http.Header, params imageserver.Params) {
+	if hp, ok := ps.Parser.(ResponseHeaderParser); ok {
+		hp.SetResponseHeader(header, params)
+	}
+}
+
 func parseSourceTransform(ps Parser, req *http.Request, params imageserver.Params, f func(string) string) error {
 	err := ps.Parse(req, params)
 	if err != nil {
@@ -126,6 +199,18 @@ func (ps *SourcePrefixParser) Parse(req *http.Request, params imageserver.Params
 	})
 }
 
+// Vary implements VaryParser.
+func (ps *SourcePrefixParser) Vary() []string {
+	return GetVary(ps.Parser)
+}
+
+// SetResponseHeader implements ResponseHeaderParser.
+func (ps *SourcePrefixParser) SetResponseHeader(header http.Header, params imageserver.Params) {
+	if hp, ok := ps.Parser.(ResponseHeaderParser); ok {
+		hp.SetResponseHeader(header, params)
+	}
+}
+
 // ParseQueryString takes the param from the HTTP URL query and add it to the Params.
 func ParseQueryString(param string, req *http.Request, params imageserver.Params) {
 	s := req.URL.Query().Get(param)
@@ -144,6 +144,8 @@ func TestSourcePathParserResolve(t *testing.T) {
 }
 
 var _ Parser = &SourceTransformParser{}
+var _ VaryParser = &SourceTransformParser{}
+var _ ResponseHeaderParser = &SourceTransformParser{}
 
 func TestSourceTransformParser(t *testing.T) {
 	req, err := http.NewRequest("GET", "http://localhost?source=foo", nil)
@@ -188,6 +190,30 @@ func TestSourceTransformParserUndefined(t *testing.T) {
 	}
 }
 
+func TestSourceTransformParserVary(t *testing.T) {
+	ps := &SourceTransformParser{
+		Parser: &testVaryParser{vary: []string{"Accept"}},
+	}
+	vary := ps.Vary()
+	if len(vary) != 1 || vary[0] != "Accept" {
+		t.Fatalf("unexpected vary: %v", vary)
+	}
+}
+
+func TestSourceTransformParserClientHints(t *testing.T) {
+	ps := &SourceTransformParser{
+		Parser: &ClientHintsParser{Parser: &SourceParser{}},
+	}
+	if vary := ps.Vary(); len(vary) != len(clientHintsVary) {
+		t.Fatalf("unexpected vary: %v", vary)
+	}
+	header := http.Header{}
+	ps.SetResponseHeader(header, imageserver.Params{DPRParam: 2.0})
+	if header.Get("Accept-CH") == "" || header.Get("Content-DPR") != "2" {
+		t.Fatalf("unexpected header: %v", header)
+	}
+}
+
 func TestSourceTransformParserErrorParse(t *testing.T) {
 	req, err := http.NewRequest("GET", "http://localhost?error=foo", nil)
 	if err != nil {
@@ -221,6 +247,8 @@ func TestSourceTransformParserErrorParams(t *testing.T) {
 }
 
 var _ Parser = &SourcePrefixParser{}
+var _ VaryParser = &SourcePrefixParser{}
+var _ ResponseHeaderParser = &SourcePrefixParser{}
 
 func TestSourcePrefixParser(t *testing.T) {
 	req, err := http.NewRequest("GET", "http://localhost?source=bar", nil)
@@ -245,6 +273,32 @@ func TestSourcePrefixParser(t *testing.T) {
 	}
 }
 
+func TestSourcePrefixParserVary(t *testing.T) {
+	ps := &SourcePrefixParser{
+		Parser: &testVaryParser{vary: []string{"Accept"}},
+		Prefix: "foo",
+	}
+	vary := ps.Vary()
+	if len(vary) != 1 || vary[0] != "Accept" {
+		t.Fatalf("unexpected vary: %v", vary)
+	}
+}
+
+func TestSourcePrefixParserClientHints(t *testing.T) {
+	ps := &SourcePrefixParser{
+		Parser: &ClientHintsParser{Parser: &SourceParser{}},
+		Prefix: "foo",
+	}
+	if vary := ps.Vary(); len(vary) != len(clientHintsVary) {
+		t.Fatalf("unexpected vary: %v", vary)
+	}
+	header := http.Header{}
+	ps.SetResponseHeader(header, imageserver.Params{DPRParam: 2.0})
+	if header.Get("Accept-CH") == "" || header.Get("Content-DPR") != "2" {
+		t.Fatalf("unexpected header: %v", header)
+	}
+}
+
 func TestParseQueryString(t *testing.T) {
 	req, err := http.NewRequest("GET", "http://localhost?string=foo", nil)
 	if err != nil {
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+)
+
+// PresetParam is the HTTP URL query param that contains the preset name.
+const PresetParam = "preset"
+
+// PresetParser is a Parser implementation that expands a named preset into Params.
+//
+// The preset name is taken from the "preset" HTTP URL query param,
+// or from the first segment of the HTTP URL path if Path is true (e.g. "/thumb_small/image.jpg").
+// In this case, the segment is removed from the path given to the underlying Parser.
+//
+// The underlying Parser parses the raw params (e.g. source, width, quality), that are merged with the preset.
+// By default, a raw param can be added to a preset, but it can not override a value of the preset.
+//
+// It returns a *imageserver.ParamError if the preset is unknown, or if a raw param is not allowed.
+type PresetParser struct {
+	Parser
+
+	// Presets contains the Params of each preset, by name.
+	// They are copied, and never modified.
+	Presets map[string]imageserver.Params
+
+	// Path takes the preset name from the first segment of the HTTP URL path.
+	Path bool
+
+	// Strict rejects the raw params (except "source"), so only presets can be used.
+	Strict bool
+
+	// AllowOverride allows the raw params to override the values of the preset.
+	AllowOverride bool
+}
+
+// Parse implements Parser.
+func (parser *PresetParser) Parse(req *http.Request, params imageserver.Params) error {
+	name, req := parser.getName(req)
+	var preset imageserver.Params
+	if name != "" {
+		p, ok := parser.Presets[name]
+		if !ok {
+			return &imageserver.ParamError{Param: PresetParam, Message: "unknown preset"}
+		}
+		preset = p
+	}
+	raw := imageserver.Params{}
+	err := parser.Parser.Parse(req, raw)
+	if err != nil {
+		return err
+	}
+	if parser.Strict {
+		for _, param := range getPresetLeafParams(raw, "") {
+			if param != imageserver.SourceParam {
+				return &imageserver.ParamError{Param: param, Message: "not allowed, use a preset"}
+			}
+		}
+	}
+	if preset != nil {
+		mergePresetParams(params, preset, true, "")
+	}
+	return mergePresetParams(params, raw, parser.AllowOverride, "")
+}
+
+func (parser *PresetParser) getName(req *http.Request) (string, *http.Request) {
+	if !parser.Path {
+		return req.URL.Query().Get(PresetParam), req
+	}
+	p := strings.TrimPrefix(req.URL.Path, "/")
+	i := strings.Index(p, "/")
+	if i < 0 {
+		return "", req
+	}
+	name := p[:i]
+	r := new(http.Request)
+	*r = *req
+	u := new(url.URL)
+	*u = *req.URL
+	u.Path = p[i:]
+	u.RawPath = ""
+	r.URL = u
+	return name, r
+}
+
+// Resolve implements Parser.
+func (parser *PresetParser) Resolve(param string) string {
+	if param == PresetParam {
+		if parser.Path {
+			return "path"
+		}
+		return PresetParam
+	}
+	return parser.Parser.Resolve(param)
+}
+
+// Vary implements VaryParser.
+func (parser *PresetParser) Vary() []string {
+	return GetVary(parser.Parser)
+}
+
+// SetResponseHeader implements ResponseHeaderParser.
+func (parser *PresetParser) SetResponseHeader(header http.Header, params imageserver.Params) {
+	if hp, ok := parser.Parser.(ResponseHeaderParser); ok {
+		hp.SetResponseHeader(header, params)
+	}
+}
+
+// mergePresetParams copies src to dst (recursively).
+//
+// If override is false, it returns a *imageserver.ParamError if a value already exists in dst.
+func mergePresetParams(dst, src imageserver.Params, override bool, prefix string) error {
+	keys := src.Keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := src[key]
+		if sub, ok := v.(imageserver.Params); ok {
+			dstSub, ok := dst[key].(imageserver.Params)
+			if !ok {
+				if dst.Has(key) && !override {
+					return newPresetOverrideError(prefix + key)
+				}
+				dstSub = imageserver.Params{}
+				dst.Set(key, dstSub)
+			}
+			err := mergePresetParams(dstSub, sub, override, prefix+key+".")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if dst.Has(key) && !override {
+			return newPresetOverrideError(prefix + key)
+		}
+		dst.Set(key, v)
+	}
+	return nil
+}
+
+func newPresetOverrideError(param string) *imageserver.ParamError {
+	return &imageserver.ParamError{Param: param, Message: "can not override the preset"}
+}
+
+// getPresetLeafParams returns the full names of the non-Params values (e.g. "gift_resize.width"), sorted.
+func getPresetLeafParams(params imageserver.Params, prefix string) []string {
+	var leafs []string
+	for key, v := range params {
+		if sub, ok := v.(imageserver.Params); ok {
+			leafs = append(leafs, getPresetLeafParams(sub, prefix+key+".")...)
+			continue
+		}
+		leafs = append(leafs, prefix+key)
+	}
+	sort.Strings(leafs)
+	return leafs
+}
@@ -0,0 +1,217 @@
+package http
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+)
+
+var _ Parser = &PresetParser{}
+var _ VaryParser = &PresetParser{}
+var _ ResponseHeaderParser = &PresetParser{}
+
+var testPresets = map[string]imageserver.Params{
+	"thumb_small": {
+		"resize":  imageserver.Params{"width": 100, "height": 100},
+		"quality": 80,
+	},
+	"large": {
+		"resize": imageserver.Params{"width": 1000},
+	},
+}
+
+func newTestPresetParser() *PresetParser {
+	return &PresetParser{
+		Parser: ListParser{
+			&SourceParser{},
+			&testPresetRawParser{},
+		},
+		Presets: testPresets,
+	}
+}
+
+func TestPresetParser(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		parser         *PresetParser
+		url            string
+		expectedParams imageserver.Params
+		expectedError  string
+	}{
+		{
+			name: "Query",
+			url:  "http://localhost?source=foo&preset=thumb_small",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "foo",
+				"resize":                imageserver.Params{"width": 100, "height": 100},
+				"quality":               80,
+			},
+		},
+		{
+			name: "Path",
+			parser: &PresetParser{
+				Parser:  &SourcePathParser{},
+				Presets: testPresets,
+				Path:    true,
+			},
+			url: "http://localhost/large/foo/bar.jpg",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "/foo/bar.jpg",
+				"resize":                imageserver.Params{"width": 1000},
+			},
+		},
+		{
+			name: "NoPreset",
+			url:  "http://localhost?source=foo&width=50",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "foo",
+				"resize":                imageserver.Params{"width": 50},
+			},
+		},
+		{
+			name: "Add",
+			url:  "http://localhost?source=foo&preset=large&quality=50",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "foo",
+				"resize":                imageserver.Params{"width": 1000},
+				"quality":               50,
+			},
+		},
+		{
+			name:          "OverrideNotAllowed",
+			url:           "http://localhost?source=foo&preset=large&width=50",
+			expectedError: "resize.width",
+		},
+		{
+			name: "Override",
+			parser: &PresetParser{
+				Parser:        &testPresetRawParser{},
+				Presets:       testPresets,
+				AllowOverride: true,
+			},
+			url: "http://localhost?preset=thumb_small&width=50",
+			expectedParams: imageserver.Params{
+				"resize":  imageserver.Params{"width": 50, "height": 100},
+				"quality": 80,
+			},
+		},
+		{
+			name:          "Unknown",
+			url:           "http://localhost?source=foo&preset=unknown",
+			expectedError: PresetParam,
+		},
+		{
+			name: "Strict",
+			parser: &PresetParser{
+				Parser:  ListParser{&SourceParser{}, &testPresetRawParser{}},
+				Presets: testPresets,
+				Strict:  true,
+			},
+			url: "http://localhost?source=foo&preset=large",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "foo",
+				"resize":                imageserver.Params{"width": 1000},
+			},
+		},
+		{
+			name: "StrictRaw",
+			parser: &PresetParser{
+				Parser:  ListParser{&SourceParser{}, &testPresetRawParser{}},
+				Presets: testPresets,
+				Strict:  true,
+			},
+			url:           "http://localhost?source=foo&preset=large&quality=50",
+			expectedError: "quality",
+		},
+	} {
+		func() {
+			defer func() {
+				if t.Failed() {
+					t.Logf("%s", tc.name)
+				}
+			}()
+			parser := tc.parser
+			if parser == nil {
+				parser = newTestPresetParser()
+			}
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := imageserver.Params{}
+			err = parser.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && err.Param == tc.expectedError {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedError != "" {
+				t.Fatal("no error")
+			}
+			if !reflect.DeepEqual(params, tc.expectedParams) {
+				t.Fatalf("unexpected params: got %s, want %s", params, tc.expectedParams)
+			}
+		}()
+	}
+}
+
+func TestPresetParserDoesNotModifyPresets(t *testing.T) {
+	parser := newTestPresetParser()
+	parser.AllowOverride = true
+	req, err := http.NewRequest("GET", "http://localhost?preset=large&width=50", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(req, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := testPresets["large"]["resize"].(imageserver.Params)["width"]; w != 1000 {
+		t.Fatalf("the preset is modified: %v", w)
+	}
+}
+
+func TestPresetParserResolve(t *testing.T) {
+	parser := newTestPresetParser()
+	if httpParam := parser.Resolve(PresetParam); httpParam != PresetParam {
+		t.Fatalf("unexpected result: %s", httpParam)
+	}
+	if httpParam := parser.Resolve("resize.width"); httpParam != "width" {
+		t.Fatalf("unexpected result: %s", httpParam)
+	}
+	parser.Path = true
+	if httpParam := parser.Resolve(PresetParam); httpParam != "path" {
+		t.Fatalf("unexpected result: %s", httpParam)
+	}
+}
+
+type testPresetRawParser struct{}
+
+func (parser *testPresetRawParser) Parse(req *http.Request, params imageserver.Params) error {
+	err := ParseQueryInt("quality", req, params)
+	if err != nil {
+		return err
+	}
+	resize := imageserver.Params{}
+	err = ParseQueryInt("width", req, resize)
+	if err != nil {
+		return err
+	}
+	if !resize.Empty() {
+		params.Set("resize", resize)
+	}
+	return nil
+}
+
+func (parser *testPresetRawParser) Resolve(param string) string {
+	switch param {
+	case "quality":
+		return "quality"
+	case "resize.width":
+		return "width"
+	}
+	return ""
+}
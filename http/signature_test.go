@@ -0,0 +1,146 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+)
+
+var _ Parser = &SignatureParser{}
+var _ VaryParser = &SignatureParser{}
+var _ ResponseHeaderParser = &SignatureParser{}
+
+var testSignatureKeys = [][]byte{[]byte("new key"), []byte("old key")}
+
+func newTestSignatureParser() *SignatureParser {
+	return &SignatureParser{
+		Parser: &SourceParser{},
+		Keys:   testSignatureKeys,
+		Now: func() time.Time {
+			return time.Unix(1000, 0)
+		},
+	}
+}
+
+func TestSignatureParser(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		key     []byte
+		expires time.Time
+	}{
+		{"NewKey", testSignatureKeys[0], time.Time{}},
+		{"OldKey", testSignatureKeys[1], time.Time{}},
+		{"Expires", testSignatureKeys[0], time.Unix(2000, 0)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := SignURL("http://localhost/foo?source=bar&width=100", tc.key, tc.expires)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest("GET", u, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := imageserver.Params{}
+			err = newTestSignatureParser().Parse(req, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !params.Has(imageserver.SourceParam) {
+				t.Fatal("not set")
+			}
+		})
+	}
+}
+
+func TestSignatureParserError(t *testing.T) {
+	signedURL, err := SignURL("http://localhost/foo?source=bar&width=100", testSignatureKeys[0], time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredURL, err := SignURL("http://localhost/foo?source=bar", testSignatureKeys[0], time.Unix(500, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKeyURL, err := SignURL("http://localhost/foo?source=bar", []byte("unknown"), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		url  string
+	}{
+		{"Missing", "http://localhost/foo?source=bar&width=100"},
+		{"Malformed", "http://localhost/foo?source=bar&signature=!!!"},
+		{"ModifiedQuery", strings.Replace(signedURL, "width=100", "width=5000", 1)},
+		{"AddedQuery", signedURL + "&height=5000"},
+		{"ModifiedPath", strings.Replace(signedURL, "/foo", "/other", 1)},
+		{"Expired", expiredURL},
+		{"ModifiedExpiry", strings.Replace(expiredURL, "expires=500", "expires=5000", 1)},
+		{"UnknownKey", unknownKeyURL},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = newTestSignatureParser().Parse(req, imageserver.Params{})
+			if err == nil {
+				t.Fatal("no error")
+			}
+			errHTTP, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("unexpected error type: %T", err)
+			}
+			if errHTTP.Code != http.StatusForbidden {
+				t.Fatalf("unexpected code: got %d, want %d", errHTTP.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestSignatureParserVary(t *testing.T) {
+	parser := newTestSignatureParser()
+	parser.Parser = &testVaryParser{vary: []string{"Accept"}}
+	vary := parser.Vary()
+	if len(vary) != 1 || vary[0] != "Accept" {
+		t.Fatalf("unexpected vary: %v", vary)
+	}
+}
+
+func TestSignatureParserClientHints(t *testing.T) {
+	parser := newTestSignatureParser()
+	parser.Parser = &ClientHintsParser{Parser: &SourceParser{}}
+	if vary := parser.Vary(); len(vary) != len(clientHintsVary) {
+		t.Fatalf("unexpected vary: %v", vary)
+	}
+	header := http.Header{}
+	parser.SetResponseHeader(header, imageserver.Params{DPRParam: 2.0})
+	if header.Get("Accept-CH") == "" || header.Get("Content-DPR") != "2" {
+		t.Fatalf("unexpected header: %v", header)
+	}
+}
+
+func TestSignURLReplaceSignature(t *testing.T) {
+	u1, err := SignURL("http://localhost/foo?source=bar", testSignatureKeys[0], time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u2, err := SignURL(u1, testSignatureKeys[0], time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u1 != u2 {
+		t.Fatalf("not equal: \"%s\" and \"%s\"", u1, u2)
+	}
+}
+
+func TestSignURLError(t *testing.T) {
+	_, err := SignURL("%", testSignatureKeys[0], time.Time{})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
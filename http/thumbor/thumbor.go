@@ -0,0 +1,265 @@
+// Package thumbor provides a imageserver/http.Parser implementation for Thumbor URLs.
+package thumbor
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pierrre/imageserver"
+)
+
+const (
+	cropParam   = "crop"
+	resizeParam = "gift_resize"
+	rotateParam = "gift_rotate"
+	pathParam   = "path"
+	filtersName = "filters"
+)
+
+var (
+	cropRegexp   = regexp.MustCompile(`^(\d+)x(\d+):(\d+)x(\d+)$`)
+	sizeRegexp   = regexp.MustCompile(`^(-?)(\d*|orig)x(-?)(\d*|orig)$`)
+	filterRegexp = regexp.MustCompile(`^(\w+)\(([^)]*)\)`)
+)
+
+// Parser is a imageserver/http.Parser implementation for Thumbor URLs.
+//
+// It parses the HTTP URL path with the following format:
+//  /unsafe/[AxB:CxD/][fit-in/][WxH/][HALIGN/][VALIGN/][smart/][filters:NAME(ARGS):NAME(ARGS)/]IMAGE
+//
+// The path segments are converted to params:
+//  - AxB:CxD: "crop" (see imageserver/image/crop.Processor)
+//  - WxH: "gift_resize" width and height, with the "fill" mode if both are set (see imageserver/image/gift.ResizeProcessor)
+//  - fit-in: "gift_resize" with the "fit" mode
+//  - HALIGN, VALIGN and smart are accepted but ignored (the image is always anchored at the center)
+//  - IMAGE: "source" (unchanged, use imageserver/http.SourcePrefixParser to add a prefix)
+//
+// The supported filters are:
+//  - quality(N): "quality"
+//  - format(F): "format"
+//  - rotate(N): "gift_rotate" rotation (see imageserver/image/gift.RotateProcessor)
+//
+// Signed URLs, "meta", "trim", "full-fit-in", "adaptive-fit-in", flipping and other filters are not supported,
+// and return a *imageserver.ParamError.
+type Parser struct{}
+
+// Parse implements imageserver/http.Parser.
+func (prs *Parser) Parse(req *http.Request, params imageserver.Params) error {
+	segments := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if segments[0] != "unsafe" {
+		return &imageserver.ParamError{Param: pathParam, Message: "must start with \"unsafe\" (signed URLs are not supported)"}
+	}
+	segments = segments[1:]
+	p := &parser{
+		params:   params,
+		segments: segments,
+	}
+	return p.parse()
+}
+
+type parser struct {
+	params   imageserver.Params
+	segments []string
+	resize   imageserver.Params
+}
+
+func (p *parser) parse() error {
+	for _, f := range []func(string) (bool, error){
+		p.parseUnsupported,
+		p.parseCrop,
+		p.parseFitIn,
+		p.parseSize,
+		p.parseHAlign,
+		p.parseVAlign,
+		p.parseSmart,
+		p.parseFilters,
+	} {
+		if len(p.segments) == 0 {
+			break
+		}
+		ok, err := f(p.segments[0])
+		if err != nil {
+			return err
+		}
+		if ok {
+			p.segments = p.segments[1:]
+		}
+	}
+	if p.resize != nil && !p.resize.Empty() {
+		p.params.Set(resizeParam, p.resize)
+	}
+	source := strings.Join(p.segments, "/")
+	if source == "" {
+		return &imageserver.ParamError{Param: imageserver.SourceParam, Message: "missing"}
+	}
+	p.params.Set(imageserver.SourceParam, source)
+	return nil
+}
+
+func (p *parser) parseUnsupported(s string) (bool, error) {
+	if s == "meta" || s == "trim" || strings.HasPrefix(s, "trim:") {
+		return false, newUnsupportedSegmentError(s)
+	}
+	return false, nil
+}
+
+func newUnsupportedSegmentError(s string) error {
+	return &imageserver.ParamError{Param: pathParam, Message: fmt.Sprintf("unsupported segment \"%s\"", s)}
+}
+
+func (p *parser) parseCrop(s string) (bool, error) {
+	m := cropRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return false, nil
+	}
+	var vs [4]int
+	for i := range vs {
+		v, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return false, &imageserver.ParamError{Param: cropParam, Message: err.Error()}
+		}
+		vs[i] = v
+	}
+	p.params.Set(cropParam, imageserver.Params{
+		"min_x": vs[0],
+		"min_y": vs[1],
+		"max_x": vs[2],
+		"max_y": vs[3],
+	})
+	return true, nil
+}
+
+func (p *parser) parseFitIn(s string) (bool, error) {
+	if s == "full-fit-in" || strings.HasPrefix(s, "adaptive-") {
+		return false, newUnsupportedSegmentError(s)
+	}
+	if s != "fit-in" {
+		return false, nil
+	}
+	p.getResize().Set("mode", "fit")
+	return true, nil
+}
+
+func (p *parser) parseSize(s string) (bool, error) {
+	m := sizeRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return false, nil
+	}
+	if m[1] != "" || m[3] != "" {
+		return false, &imageserver.ParamError{Param: resizeParam, Message: "flipping is not supported"}
+	}
+	resize := p.getResize()
+	for _, d := range []struct {
+		name string
+		s    string
+	}{
+		{"width", m[2]},
+		{"height", m[4]},
+	} {
+		if d.s == "" || d.s == "orig" {
+			continue
+		}
+		v, err := strconv.Atoi(d.s)
+		if err != nil {
+			return false, &imageserver.ParamError{Param: resizeParam + "." + d.name, Message: err.Error()}
+		}
+		if v != 0 {
+			resize.Set(d.name, v)
+		}
+	}
+	if resize.Has("width") && resize.Has("height") && !resize.Has("mode") {
+		resize.Set("mode", "fill")
+	}
+	return true, nil
+}
+
+func (p *parser) getResize() imageserver.Params {
+	if p.resize == nil {
+		p.resize = imageserver.Params{}
+	}
+	return p.resize
+}
+
+func (p *parser) parseHAlign(s string) (bool, error) {
+	return s == "left" || s == "center" || s == "right", nil
+}
+
+func (p *parser) parseVAlign(s string) (bool, error) {
+	return s == "top" || s == "middle" || s == "bottom", nil
+}
+
+func (p *parser) parseSmart(s string) (bool, error) {
+	return s == "smart", nil
+}
+
+func (p *parser) parseFilters(s string) (bool, error) {
+	if !strings.HasPrefix(s, filtersName+":") {
+		return false, nil
+	}
+	s = strings.TrimPrefix(s, filtersName+":")
+	for s != "" {
+		m := filterRegexp.FindStringSubmatch(s)
+		if m == nil {
+			return false, &imageserver.ParamError{Param: filtersName, Message: fmt.Sprintf("invalid filter \"%s\"", s)}
+		}
+		err := p.parseFilter(m[1], m[2])
+		if err != nil {
+			return false, err
+		}
+		s = strings.TrimPrefix(s[len(m[0]):], ":")
+	}
+	return true, nil
+}
+
+func (p *parser) parseFilter(name string, arg string) error {
+	switch name {
+	case "quality":
+		v, err := strconv.Atoi(arg)
+		if err != nil {
+			return &imageserver.ParamError{Param: "quality", Message: err.Error()}
+		}
+		p.params.Set("quality", v)
+	case "format":
+		if arg == "jpg" {
+			arg = "jpeg"
+		}
+		p.params.Set("format", arg)
+	case "rotate":
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return &imageserver.ParamError{Param: rotateParam + ".rotation", Message: err.Error()}
+		}
+		p.params.Set(rotateParam, imageserver.Params{"rotation": v})
+	default:
+		return &imageserver.ParamError{Param: filtersName, Message: fmt.Sprintf("unsupported filter \"%s\"", name)}
+	}
+	return nil
+}
+
+// Resolve implements imageserver/http.Parser.
+//
+// It returns the name of the path segment.
+func (prs *Parser) Resolve(param string) string {
+	switch {
+	case param == imageserver.SourceParam:
+		return "image"
+	case param == pathParam:
+		return pathParam
+	case param == cropParam || strings.HasPrefix(param, cropParam+"."):
+		return "crop"
+	case param == resizeParam+".mode":
+		return "fit-in"
+	case param == resizeParam || strings.HasPrefix(param, resizeParam+"."):
+		return "size"
+	case param == filtersName:
+		return filtersName
+	case param == "quality" || param == "format":
+		return filtersName + ":" + param
+	case param == rotateParam || strings.HasPrefix(param, rotateParam+"."):
+		return filtersName + ":rotate"
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package thumbor
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	imageserver_http "github.com/pierrre/imageserver/http"
+)
+
+var _ imageserver_http.Parser = &Parser{}
+
+func TestParserParse(t *testing.T) {
+	type TC struct {
+		path               string
+		expectedParams     imageserver.Params
+		expectedParamError string
+	}
+	for _, tc := range []TC{
+		{
+			path:           "/unsafe/path/to/img.jpg",
+			expectedParams: imageserver.Params{imageserver.SourceParam: "path/to/img.jpg"},
+		},
+		{
+			path: "/unsafe/300x200/smart/filters:quality(80)/path/to/img.jpg",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "path/to/img.jpg",
+				resizeParam: imageserver.Params{
+					"width":  300,
+					"height": 200,
+					"mode":   "fill",
+				},
+				"quality": 80,
+			},
+		},
+		{
+			path: "/unsafe/10x20:110x220/fit-in/300x0/left/top/img.jpg",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "img.jpg",
+				cropParam: imageserver.Params{
+					"min_x": 10,
+					"min_y": 20,
+					"max_x": 110,
+					"max_y": 220,
+				},
+				resizeParam: imageserver.Params{
+					"width": 300,
+					"mode":  "fit",
+				},
+			},
+		},
+		{
+			path: "/unsafe/origx100/filters:format(jpg):rotate(90):quality(50)/http://example.com/img.png",
+			expectedParams: imageserver.Params{
+				imageserver.SourceParam: "http://example.com/img.png",
+				resizeParam: imageserver.Params{
+					"height": 100,
+				},
+				"format":    "jpeg",
+				rotateParam: imageserver.Params{"rotation": 90.0},
+				"quality":   50,
+			},
+		},
+		{path: "/foo/img.jpg", expectedParamError: pathParam},
+		{path: "/unsafe/meta/img.jpg", expectedParamError: pathParam},
+		{path: "/unsafe/trim/img.jpg", expectedParamError: pathParam},
+		{path: "/unsafe/full-fit-in/img.jpg", expectedParamError: pathParam},
+		{path: "/unsafe/-300x200/img.jpg", expectedParamError: resizeParam},
+		{path: "/unsafe/filters:blur(7)/img.jpg", expectedParamError: filtersName},
+		{path: "/unsafe/filters:quality/img.jpg", expectedParamError: filtersName},
+		{path: "/unsafe/filters:quality(high)/img.jpg", expectedParamError: "quality"},
+		{path: "/unsafe/filters:rotate(left)/img.jpg", expectedParamError: rotateParam + ".rotation"},
+		{path: "/unsafe/300x200/", expectedParamError: imageserver.SourceParam},
+		{path: "/unsafe", expectedParamError: imageserver.SourceParam},
+	} {
+		func() {
+			defer func() {
+				if t.Failed() {
+					t.Logf("%#v", tc)
+				}
+			}()
+			req, err := http.NewRequest("GET", "http://localhost"+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prs := &Parser{}
+			params := imageserver.Params{}
+			err = prs.Parse(req, params)
+			if err != nil {
+				if err, ok := err.(*imageserver.ParamError); ok && tc.expectedParamError == err.Param {
+					return
+				}
+				t.Fatal(err)
+			}
+			if tc.expectedParamError != "" {
+				t.Fatal("no error")
+			}
+			if params.String() != tc.expectedParams.String() {
+				t.Fatalf("unexpected params: got %s, want %s", params, tc.expectedParams)
+			}
+		}()
+	}
+}
+
+func TestParserResolve(t *testing.T) {
+	prs := &Parser{}
+	for param, expected := range map[string]string{
+		imageserver.SourceParam:   "image",
+		pathParam:                 "path",
+		cropParam:                 "crop",
+		cropParam + ".min_x":      "crop",
+		resizeParam + ".width":    "size",
+		resizeParam + ".mode":     "fit-in",
+		filtersName:               "filters",
+		"quality":                 "filters:quality",
+		"format":                  "filters:format",
+		rotateParam + ".rotation": "filters:rotate",
+		"foo":                     "",
+	} {
+		if httpParam := prs.Resolve(param); httpParam != expected {
+			t.Fatalf("unexpected result for \"%s\": got \"%s\", want \"%s\"", param, httpParam, expected)
+		}
+	}
+}
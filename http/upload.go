@@ -0,0 +1,156 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/internal/sniff"
+)
+
+const (
+	// DefaultUploadMaxSize is the default maximum size of an uploaded Image (32 MiB).
+	DefaultUploadMaxSize = 32 << 20
+
+	// DefaultUploadFormField is the default name of the multipart form field that contains the uploaded Image.
+	DefaultUploadFormField = "image"
+)
+
+// UploadHandler is a net/http.Handler implementation that processes an Image sent in the HTTP request body.
+//
+// Supported method is POST.
+// Other method will return a StatusMethodNotAllowed/405 response.
+//
+// The Image is either the raw body, or a file of a multipart form (see FormField).
+// The format is detected from the content.
+// The Params are parsed from the HTTP request by Parser (e.g. from the URL query).
+// The Image is not stored, it is processed by Handler and sent in the response.
+//
+// Errors are handled like Handler.
+// A body greater than MaxSize returns a StatusRequestEntityTooLarge/413 response.
+type UploadHandler struct {
+	// Parser parses the HTTP request and fills the Params.
+	Parser Parser
+
+	// Handler processes the uploaded Image.
+	Handler imageserver.Handler
+
+	// MaxSize is an optional maximum Image size (in bytes).
+	// DefaultUploadMaxSize is used by default.
+	MaxSize int64
+
+	// FormField is an optional name of the multipart form field that contains the Image.
+	// DefaultUploadFormField is used by default.
+	FormField string
+
+	// ErrorFunc is an optional function that is called if there is an internal error.
+	ErrorFunc func(err error, req *http.Request)
+}
+
+// ServeHTTP implements net/http.Handler.
+func (handler *UploadHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	err := handler.serveHTTP(rw, req)
+	if err != nil {
+		SendError(rw, req, err, handler.Parser, handler.ErrorFunc)
+	}
+}
+
+func (handler *UploadHandler) serveHTTP(rw http.ResponseWriter, req *http.Request) error {
+	if req.Method != "POST" {
+		rw.Header().Set("Allow", "POST")
+		return NewErrorDefaultText(http.StatusMethodNotAllowed)
+	}
+	params := imageserver.Params{}
+	err := handler.Parser.Parse(req, params)
+	if err != nil {
+		return err
+	}
+	im, err := handler.readImage(req)
+	if err != nil {
+		return err
+	}
+	im, err = imageserver.HandleWithContext(req.Context(), handler.Handler, im, params)
+	if err != nil {
+		return err
+	}
+	if hp, ok := handler.Parser.(ResponseHeaderParser); ok {
+		hp.SetResponseHeader(rw.Header(), params)
+	}
+	if im.Format != "" {
+		rw.Header().Set("Content-Type", "image/"+im.Format)
+	}
+	rw.Header().Set("Content-Length", strconv.Itoa(len(im.Data)))
+	rw.Write(im.Data)
+	return nil
+}
+
+func (handler *UploadHandler) readImage(req *http.Request) (*imageserver.Image, error) {
+	r, err := handler.getImageReader(req)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := handler.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultUploadMaxSize
+	}
+	if req.ContentLength > maxSize && r == req.Body {
+		return nil, newUploadSizeError(maxSize)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, newUploadSizeError(maxSize)
+	}
+	if len(data) == 0 {
+		return nil, &Error{Code: http.StatusBadRequest, Text: "empty image"}
+	}
+	format := sniff.Format(data)
+	if format == "" {
+		return nil, &imageserver.ImageError{Message: "unknown image format"}
+	}
+	return &imageserver.Image{
+		Format: format,
+		Data:   data,
+	}, nil
+}
+
+// getImageReader returns the file of the multipart form, or the body.
+func (handler *UploadHandler) getImageReader(req *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return req.Body, nil
+	}
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, &Error{Code: http.StatusBadRequest, Text: fmt.Sprintf("invalid multipart form: %s", err)}
+	}
+	field := handler.FormField
+	if field == "" {
+		field = DefaultUploadFormField
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, &Error{Code: http.StatusBadRequest, Text: fmt.Sprintf("missing multipart form field \"%s\"", field)}
+		}
+		if err != nil {
+			return nil, &Error{Code: http.StatusBadRequest, Text: fmt.Sprintf("invalid multipart form: %s", err)}
+		}
+		if part.FormName() == field {
+			return part, nil
+		}
+	}
+}
+
+func newUploadSizeError(maxSize int64) error {
+	return &Error{
+		Code: http.StatusRequestEntityTooLarge,
+		Text: fmt.Sprintf("image size is greater than the maximum value %d", maxSize),
+	}
+}
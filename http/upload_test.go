@@ -0,0 +1,152 @@
+package http
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+var _ http.Handler = &UploadHandler{}
+
+type testQueryParser struct{}
+
+func (parser *testQueryParser) Parse(req *http.Request, params imageserver.Params) error {
+	return ParseQueryInt("width", req, params)
+}
+
+func (parser *testQueryParser) Resolve(param string) string {
+	return ""
+}
+
+func newTestUploadHandler(t *testing.T) *UploadHandler {
+	return &UploadHandler{
+		Parser: &testQueryParser{},
+		Handler: imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+			if !imageserver.ImageEqual(im, testdata.Medium) {
+				t.Fatal("unexpected image")
+			}
+			width, err := params.GetInt("width")
+			if err != nil {
+				return nil, err
+			}
+			if width != 100 {
+				t.Fatalf("unexpected width: %d", width)
+			}
+			return testdata.Small, nil
+		}),
+	}
+}
+
+func TestUploadHandlerRaw(t *testing.T) {
+	h := newTestUploadHandler(t)
+	req := httptest.NewRequest("POST", "http://localhost?width=100", bytes.NewReader(testdata.Medium.Data))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Equal(w.Body.Bytes(), testdata.Small.Data) {
+		t.Fatal("unexpected body")
+	}
+	if v := w.Header().Get("Content-Type"); v != "image/jpeg" {
+		t.Fatalf("unexpected Content-Type: %s", v)
+	}
+}
+
+func newTestMultipartRequest(t *testing.T, field string, data []byte) *http.Request {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	err := mw.WriteField("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw, err := mw.CreateFormFile(field, "image.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "http://localhost?width=100", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadHandlerMultipart(t *testing.T) {
+	h := newTestUploadHandler(t)
+	req := newTestMultipartRequest(t, DefaultUploadFormField, testdata.Medium.Data)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected http status: %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Equal(w.Body.Bytes(), testdata.Small.Data) {
+		t.Fatal("unexpected body")
+	}
+}
+
+func TestUploadHandlerError(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		handler      *UploadHandler
+		req          *http.Request
+		expectedCode int
+	}{
+		{
+			name:         "Method",
+			req:          httptest.NewRequest("GET", "http://localhost?width=100", nil),
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:         "Parser",
+			req:          httptest.NewRequest("POST", "http://localhost?width=invalid", bytes.NewReader(testdata.Medium.Data)),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "MaxSize",
+			handler:      &UploadHandler{Parser: &testQueryParser{}, MaxSize: 100},
+			req:          httptest.NewRequest("POST", "http://localhost?width=100", bytes.NewReader(testdata.Medium.Data)),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "MaxSizeMultipart",
+			handler:      &UploadHandler{Parser: &testQueryParser{}, MaxSize: 100},
+			req:          newTestMultipartRequest(t, DefaultUploadFormField, testdata.Medium.Data),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "Empty",
+			req:          httptest.NewRequest("POST", "http://localhost?width=100", nil),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "UnknownFormat",
+			req:          httptest.NewRequest("POST", "http://localhost?width=100", bytes.NewReader([]byte("not an image"))),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "MissingField",
+			req:          newTestMultipartRequest(t, "other", testdata.Medium.Data),
+			expectedCode: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := tc.handler
+			if h == nil {
+				h = newTestUploadHandler(t)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tc.req)
+			if w.Code != tc.expectedCode {
+				t.Fatalf("unexpected http status: got %d, want %d", w.Code, tc.expectedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package httpsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestFailoverServer(t *testing.T) {
+	secondary := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "image/jpeg")
+		rw.Write(testdata.Medium.Data)
+	}))
+	defer secondary.Close()
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refused.Close()
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	for _, tc := range []struct {
+		name             string
+		primaryURL       string
+		failoverFunc     func(error) bool
+		expectedFailover bool
+	}{
+		{"TransportWithConnectionRefused", refused.URL, imageserver.FailoverTransport, true},
+		{"TransportWithUnavailable", unavailable.URL, imageserver.FailoverTransport, true},
+		{"TransportWithNotFound", notFound.URL, imageserver.FailoverTransport, false},
+		{"NotFoundWithConnectionRefused", refused.URL, imageserver.FailoverNotFound, false},
+		{"NotFoundWithUnavailable", unavailable.URL, imageserver.FailoverNotFound, false},
+		{"NotFoundWithNotFound", notFound.URL, imageserver.FailoverNotFound, true},
+		{"DefaultWithConnectionRefused", refused.URL, imageserver.FailoverDefault, true},
+		{"DefaultWithNotFound", notFound.URL, imageserver.FailoverDefault, true},
+	} {
+		func() {
+			defer func() {
+				if t.Failed() {
+					t.Logf("%s", tc.name)
+				}
+			}()
+			srv := &imageserver.FailoverServer{
+				Origins: []*imageserver.Origin{
+					{Name: "primary", Server: &Server{}, SourceFunc: imageserver.SourcePrefix(tc.primaryURL)},
+					{Name: "secondary", Server: &Server{}, SourceFunc: imageserver.SourcePrefix(secondary.URL)},
+				},
+				FailoverFunc: tc.failoverFunc,
+			}
+			im, err := srv.Get(imageserver.Params{imageserver.SourceParam: "/image.jpg"})
+			if !tc.expectedFailover {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if im.Metadata[imageserver.OriginMetadata] != "secondary" {
+				t.Fatalf("unexpected origin: %s", im.Metadata[imageserver.OriginMetadata])
+			}
+		}()
+	}
+}
@@ -2,13 +2,20 @@
 package httpsource
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/internal/sniff"
 )
 
 var contentTypeRegexp = regexp.MustCompile("^image/(.+)$")
@@ -17,30 +24,111 @@ var contentTypeRegexp = regexp.MustCompile("^image/(.+)$")
 //
 // It parses the "source" param as URL, then do a GET request.
 // It returns an error if the HTTP status code is not 200 (OK).
+// For 404 (Not Found) and 410 (Gone), it is a *imageserver.ParamError with NotFound set (see imageserver.NewSourceNotFoundError).
 //
 // The Image type is determined by the "Content-Type" header.
+// If the header is missing or is not an image type (e.g. "application/octet-stream"), the type is detected from the content (magic bytes).
+//
+// The HTTP validators and the freshness lifetime of the response are stored in the Image metadata (see MetadataETag).
+// They are used by Revalidate.
+//
+// If MaxSize is set, the download is aborted as soon as the size is known to be greater (from the "Content-Length" header, or while reading).
+//
+// If HostPolicy is set, the host of the URL and of each redirect is checked, and the resolved IP address is checked when connecting.
+// A denied request returns a *imageserver.ParamError for the "source" param.
 type Server struct {
 	// Client is an optional HTTP client.
 	// http.DefaultClient is used by default.
+	//
+	// If HostPolicy, ConnectTimeout or HeaderTimeout is set, the Client's Transport must be nil or a *net/http.Transport.
+	// It is copied, and its dialer is replaced.
+	// If HostPolicy is set, the proxy is disabled.
 	Client *http.Client
+
+	// HostPolicy is an optional HostPolicy.
+	HostPolicy *HostPolicy
+
+	// MaxRedirects is an optional maximum number of redirects.
+	// 0 means the Client's default behavior, and a negative value means that redirects are not followed.
+	MaxRedirects int
+
+	// MaxSize is an optional maximum response body size (in bytes).
+	MaxSize int64
+
+	// ConnectTimeout is an optional timeout for the connection.
+	ConnectTimeout time.Duration
+
+	// HeaderTimeout is an optional timeout for the response headers, after the request is sent.
+	HeaderTimeout time.Duration
+
+	// Timeout is an optional timeout for the whole download, including redirects and the response body.
+	Timeout time.Duration
+
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
 }
 
 // Get implements Server.
 func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+//
+// The HTTP request is canceled if the context is done.
+func (srv *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	return srv.get(ctx, params, nil)
+}
+
+func (srv *Server) get(ctx context.Context, params imageserver.Params, cached *imageserver.Image) (*imageserver.Image, error) {
 	sourceURL, err := getSourceURL(params)
 	if err != nil {
 		return nil, err
 	}
-	response, err := srv.doRequest(sourceURL)
+	if srv.HostPolicy != nil {
+		err = srv.HostPolicy.CheckHost(sourceURL.Hostname())
+		if err != nil {
+			return nil, &imageserver.ParamError{Param: imageserver.SourceParam, Message: err.Error()}
+		}
+	}
+	reqCtx := ctx
+	if srv.Timeout != 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, srv.Timeout)
+		defer cancel()
+	}
+	image, err := srv.download(reqCtx, sourceURL, cached)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if reqCtx.Err() != nil {
+			return nil, &imageserver.ParamError{
+				Param:   imageserver.SourceParam,
+				Message: fmt.Sprintf("download timeout after %s", srv.Timeout),
+			}
+		}
+		return nil, err
+	}
+	return image, nil
+}
+
+func (srv *Server) download(ctx context.Context, sourceURL *url.URL, cached *imageserver.Image) (*imageserver.Image, error) {
+	response, err := srv.doRequest(ctx, sourceURL, cached)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
-	image, err := parseResponse(response)
+	if cached != nil && response.StatusCode == http.StatusNotModified {
+		return newRevalidatedImage(cached, response), nil
+	}
+	im, err := parseResponse(response, srv.MaxSize)
 	if err != nil {
 		return nil, err
 	}
-	return image, nil
+	im.Metadata = getResponseMetadata(response)
+	return im, nil
 }
 
 func getSourceURL(params imageserver.Params) (*url.URL, error) {
@@ -64,25 +152,120 @@ func getSourceURL(params imageserver.Params) (*url.URL, error) {
 	return sourceURL, nil
 }
 
-func (srv *Server) doRequest(sourceURL *url.URL) (*http.Response, error) {
-	c := srv.Client
-	if c == nil {
-		c = http.DefaultClient
+func (srv *Server) doRequest(ctx context.Context, sourceURL *url.URL, cached *imageserver.Image) (*http.Response, error) {
+	c, err := srv.getClient()
+	if err != nil {
+		return nil, err
 	}
-	response, err := c.Get(sourceURL.String())
+	req, err := http.NewRequest("GET", sourceURL.String(), nil)
 	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if cached != nil {
+		setConditionalHeaders(req, cached)
+	}
+	response, err := c.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, &imageserver.ParamError{Param: imageserver.SourceParam, Message: err.Error()}
 	}
 	return response, nil
 }
 
-func parseResponse(response *http.Response) (*imageserver.Image, error) {
+func (srv *Server) getClient() (*http.Client, error) {
+	if !srv.needsTransport() && srv.MaxRedirects == 0 {
+		if srv.Client != nil {
+			return srv.Client, nil
+		}
+		return http.DefaultClient, nil
+	}
+	srv.clientOnce.Do(func() {
+		srv.client, srv.clientErr = srv.newClient()
+	})
+	return srv.client, srv.clientErr
+}
+
+func (srv *Server) newClient() (*http.Client, error) {
+	c := new(http.Client)
+	if srv.Client != nil {
+		*c = *srv.Client
+	}
+	if srv.needsTransport() {
+		var t *http.Transport
+		switch ct := c.Transport.(type) {
+		case nil:
+			t = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			t = ct.Clone()
+		default:
+			return nil, fmt.Errorf("unsupported transport type %T", c.Transport)
+		}
+		srv.configureTransport(t)
+		c.Transport = t
+	}
+	checkRedirect := c.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if srv.MaxRedirects < 0 || (srv.MaxRedirects > 0 && len(via) > srv.MaxRedirects) {
+			return fmt.Errorf("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect url scheme must be http(s)")
+		}
+		if srv.HostPolicy != nil {
+			err := srv.HostPolicy.CheckHost(req.URL.Hostname())
+			if err != nil {
+				return err
+			}
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return c, nil
+}
+
+func (srv *Server) needsTransport() bool {
+	return srv.HostPolicy != nil || srv.ConnectTimeout != 0 || srv.HeaderTimeout != 0
+}
+
+func (srv *Server) configureTransport(t *http.Transport) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if srv.ConnectTimeout != 0 {
+		dialer.Timeout = srv.ConnectTimeout
+	}
+	if srv.HostPolicy != nil {
+		dialer.Control = srv.HostPolicy.dialControl
+		t.Proxy = nil
+	}
+	t.DialContext = dialer.DialContext
+	if srv.HeaderTimeout != 0 {
+		t.ResponseHeaderTimeout = srv.HeaderTimeout
+	}
+}
+
+func parseResponse(response *http.Response, maxSize int64) (*imageserver.Image, error) {
+	if response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone {
+		return nil, imageserver.NewSourceNotFoundError(fmt.Sprintf("http status code %d while downloading", response.StatusCode))
+	}
 	if response.StatusCode != http.StatusOK {
 		return nil, &imageserver.ParamError{
 			Param:   imageserver.SourceParam,
 			Message: fmt.Sprintf("http status code %d while downloading", response.StatusCode),
 		}
 	}
+	if maxSize > 0 && response.ContentLength > maxSize {
+		return nil, newSizeError(maxSize)
+	}
 	im := new(imageserver.Image)
 	contentType := response.Header.Get("Content-Type")
 	if contentType != "" {
@@ -91,13 +274,30 @@ func parseResponse(response *http.Response) (*imageserver.Image, error) {
 			im.Format = matches[1]
 		}
 	}
-	data, err := ioutil.ReadAll(response.Body)
+	var r io.Reader = response.Body
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, &imageserver.ParamError{
 			Param:   imageserver.SourceParam,
 			Message: fmt.Sprintf("error while downloading: %s", err),
 		}
 	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, newSizeError(maxSize)
+	}
+	if im.Format == "" {
+		im.Format = sniff.Format(data)
+	}
 	im.Data = data
 	return im, nil
 }
+
+func newSizeError(maxSize int64) error {
+	return &imageserver.ParamError{
+		Param:   imageserver.SourceParam,
+		Message: "response size is greater than the maximum value " + strconv.FormatInt(maxSize, 10),
+	}
+}
@@ -1,10 +1,12 @@
 package httpsource
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/pierrre/imageserver"
 	"github.com/pierrre/imageserver/testdata"
@@ -115,7 +117,7 @@ func TestParseResponseErrorData(t *testing.T) {
 		StatusCode: http.StatusOK,
 		Body:       &errorReadCloser{},
 	}
-	_, err := parseResponse(response)
+	_, err := parseResponse(response, 0)
 	if err == nil {
 		t.Fatal("no error")
 	}
@@ -131,3 +133,105 @@ func createTestHTTPServer(t *testing.T) *httptest.Server {
 func createTestSource(srv *httptest.Server, filename string) string {
 	return fmt.Sprintf("http://%s/%s", srv.Listener.Addr(), filename)
 }
+
+var _ imageserver.ContextServer = &Server{}
+
+func TestGetContextCanceled(t *testing.T) {
+	block := make(chan struct{})
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-block
+	}))
+	defer httpSrv.Close()
+	defer close(block)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	params := imageserver.Params{
+		imageserver.SourceParam: httpSrv.URL,
+	}
+	srv := &Server{}
+	_, err := srv.GetContext(ctx, params)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGetFormatSniffing(t *testing.T) {
+	for _, contentType := range []string{"", "application/octet-stream"} {
+		httpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header()["Content-Type"] = []string{contentType}
+			rw.Write(testdata.Medium.Data)
+		}))
+		srv := &Server{}
+		im, err := srv.Get(imageserver.Params{imageserver.SourceParam: httpSrv.URL})
+		httpSrv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if im.Format != testdata.Medium.Format {
+			t.Fatalf("unexpected image format for content type \"%s\": got \"%s\", want \"%s\"", contentType, im.Format, testdata.Medium.Format)
+		}
+	}
+}
+
+func TestGetMaxSize(t *testing.T) {
+	httpSrv := createTestHTTPServer(t)
+	defer httpSrv.Close()
+	srv := &Server{
+		MaxSize: int64(len(testdata.Medium.Data)),
+	}
+	_, err := srv.Get(imageserver.Params{imageserver.SourceParam: createTestSource(httpSrv, testdata.MediumFileName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.MaxSize--
+	_, err = srv.Get(imageserver.Params{imageserver.SourceParam: createTestSource(httpSrv, testdata.MediumFileName)})
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGetMaxSizeNoContentLength(t *testing.T) {
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "image/jpeg")
+		rw.WriteHeader(http.StatusOK)
+		for i := 0; i < 10; i++ {
+			rw.Write(testdata.Medium.Data)
+			rw.(http.Flusher).Flush()
+		}
+	}))
+	defer httpSrv.Close()
+	srv := &Server{
+		MaxSize: int64(len(testdata.Medium.Data)),
+	}
+	_, err := srv.Get(imageserver.Params{imageserver.SourceParam: httpSrv.URL})
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGetTimeouts(t *testing.T) {
+	block := make(chan struct{})
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/body" {
+			rw.WriteHeader(http.StatusOK)
+			rw.(http.Flusher).Flush()
+		}
+		<-block
+	}))
+	defer httpSrv.Close()
+	defer close(block)
+	for _, tc := range []struct {
+		srv  *Server
+		path string
+	}{
+		{&Server{HeaderTimeout: 10 * time.Millisecond}, "/header"},
+		{&Server{Timeout: 10 * time.Millisecond}, "/header"},
+		{&Server{Timeout: 10 * time.Millisecond}, "/body"},
+		{&Server{ConnectTimeout: 1 * time.Second, HeaderTimeout: 10 * time.Millisecond}, "/header"},
+	} {
+		_, err := tc.srv.Get(imageserver.Params{imageserver.SourceParam: httpSrv.URL + tc.path})
+		if _, ok := err.(*imageserver.ParamError); !ok {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package httpsource
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// DefaultDenyNetworks contains the networks that should not be reachable from a public image server.
+//
+// It includes loopback, private, link-local (cloud metadata), carrier-grade NAT, multicast and reserved addresses.
+var DefaultDenyNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// ParseCIDRs parses a list of CIDR notation networks.
+func ParseCIDRs(ss ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(ss))
+	for _, s := range ss {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func mustParseCIDRs(ss ...string) []*net.IPNet {
+	nets, err := ParseCIDRs(ss...)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// HostPolicy restricts the hosts that can be reached by Server.
+//
+// Host patterns are case insensitive, and "*.example.com" matches all subdomains of "example.com" (but not "example.com").
+//
+// Networks are checked against the resolved IP address when the connection is established,
+// so a DNS response that changes between the check and the connection (DNS rebinding) can not bypass them.
+// IPv4-mapped IPv6 addresses are checked as IPv4 addresses.
+type HostPolicy struct {
+	// AllowHosts is an optional list of allowed host patterns.
+	// If it is not empty, other hosts are denied.
+	AllowHosts []string
+
+	// DenyHosts is an optional list of denied host patterns.
+	DenyHosts []string
+
+	// AllowNetworks is an optional list of allowed networks.
+	// If it is not empty, other IP addresses are denied.
+	AllowNetworks []*net.IPNet
+
+	// DenyNetworks is an optional list of denied networks.
+	// It has priority over AllowNetworks.
+	DenyNetworks []*net.IPNet
+}
+
+// NewHostPolicy creates a new HostPolicy that denies DefaultDenyNetworks.
+func NewHostPolicy() *HostPolicy {
+	return &HostPolicy{
+		DenyNetworks: DefaultDenyNetworks,
+	}
+}
+
+// CheckHost returns an error if the host (without port) is not allowed.
+//
+// If the host is an IP address, it is also checked with CheckIP.
+func (p *HostPolicy) CheckHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(ip)
+	}
+	if matchHostPatterns(host, p.DenyHosts) {
+		return &PolicyError{Message: fmt.Sprintf("host \"%s\" is denied", host)}
+	}
+	if len(p.AllowHosts) > 0 && !matchHostPatterns(host, p.AllowHosts) {
+		return &PolicyError{Message: fmt.Sprintf("host \"%s\" is not allowed", host)}
+	}
+	return nil
+}
+
+// CheckIP returns an error if the IP address is not allowed.
+func (p *HostPolicy) CheckIP(ip net.IP) error {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if matchNetworks(ip, p.DenyNetworks) {
+		return &PolicyError{Message: fmt.Sprintf("ip address %s is denied", ip)}
+	}
+	if len(p.AllowNetworks) > 0 && !matchNetworks(ip, p.AllowNetworks) {
+		return &PolicyError{Message: fmt.Sprintf("ip address %s is not allowed", ip)}
+	}
+	return nil
+}
+
+// NewTransport returns a new *net/http.Transport that checks the IP address before connecting.
+//
+// It is based on http.DefaultTransport, without proxy (the IP address of the proxy would be checked instead of the target).
+func (p *HostPolicy) NewTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	srv := &Server{HostPolicy: p}
+	srv.configureTransport(t)
+	return t
+}
+
+func (p *HostPolicy) dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &PolicyError{Message: fmt.Sprintf("invalid ip address %s", host)}
+	}
+	return p.CheckIP(ip)
+}
+
+func matchHostPatterns(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func matchNetworks(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyError is returned when a HostPolicy denies a host or an IP address.
+type PolicyError struct {
+	Message string
+}
+
+func (err *PolicyError) Error() string {
+	return fmt.Sprintf("host policy: %s", err.Message)
+}
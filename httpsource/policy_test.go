@@ -0,0 +1,183 @@
+package httpsource
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestHostPolicyCheckHost(t *testing.T) {
+	p := &HostPolicy{
+		AllowHosts: []string{"example.com", "*.example.org"},
+		DenyHosts:  []string{"private.example.org"},
+	}
+	for _, tc := range []struct {
+		host    string
+		allowed bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com.", true},
+		{"www.example.com", false},
+		{"img.example.org", true},
+		{"example.org", false},
+		{"private.example.org", false},
+		{"evil.com", false},
+	} {
+		err := p.CheckHost(tc.host)
+		if (err == nil) != tc.allowed {
+			t.Fatalf("unexpected result for host \"%s\": %v", tc.host, err)
+		}
+		if err != nil {
+			if _, ok := err.(*PolicyError); !ok {
+				t.Fatalf("unexpected error type: %T", err)
+			}
+		}
+	}
+}
+
+func TestHostPolicyCheckIP(t *testing.T) {
+	p := NewHostPolicy()
+	for _, tc := range []struct {
+		ip      string
+		allowed bool
+	}{
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"169.254.169.254", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+	} {
+		err := p.CheckIP(net.ParseIP(tc.ip))
+		if (err == nil) != tc.allowed {
+			t.Fatalf("unexpected result for ip %s: %v", tc.ip, err)
+		}
+	}
+	allowNets, err := ParseCIDRs("8.8.8.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AllowNetworks = allowNets
+	if err := p.CheckIP(net.ParseIP("8.8.4.4")); err == nil {
+		t.Fatal("no error")
+	}
+	if err := p.CheckIP(net.ParseIP("8.8.8.8")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseCIDRsError(t *testing.T) {
+	_, err := ParseCIDRs("foo")
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func TestGetHostPolicyDenied(t *testing.T) {
+	httpSrv := createTestHTTPServer(t)
+	defer httpSrv.Close()
+	srv := &Server{
+		HostPolicy: NewHostPolicy(),
+	}
+	for _, source := range []string{
+		createTestSource(httpSrv, testdata.MediumFileName),
+		// The host is allowed, but it resolves to a denied IP address.
+		strings.Replace(createTestSource(httpSrv, testdata.MediumFileName), "127.0.0.1", "localhost", 1),
+	} {
+		_, err := srv.Get(imageserver.Params{imageserver.SourceParam: source})
+		if _, ok := err.(*imageserver.ParamError); !ok {
+			t.Fatalf("unexpected error for source %s: %v", source, err)
+		}
+		if !strings.Contains(err.Error(), "host policy") {
+			t.Fatalf("unexpected error for source %s: %v", source, err)
+		}
+	}
+}
+
+func TestGetHostPolicyAllowed(t *testing.T) {
+	httpSrv := createTestHTTPServer(t)
+	defer httpSrv.Close()
+	allowNets, err := ParseCIDRs("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		Client: &http.Client{Transport: &http.Transport{}},
+		HostPolicy: &HostPolicy{
+			AllowNetworks: allowNets,
+		},
+	}
+	im, err := srv.Get(imageserver.Params{imageserver.SourceParam: createTestSource(httpSrv, testdata.MediumFileName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imageserver.ImageEqual(im, testdata.Medium) {
+		t.Fatal("not equal")
+	}
+}
+
+func TestGetHostPolicyErrorTransport(t *testing.T) {
+	srv := &Server{
+		Client:     &http.Client{Transport: http.NewFileTransport(http.Dir(testdata.Dir))},
+		HostPolicy: &HostPolicy{},
+	}
+	_, err := srv.Get(imageserver.Params{imageserver.SourceParam: "http://example.com/" + testdata.MediumFileName})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func TestGetRedirect(t *testing.T) {
+	httpSrv := createTestHTTPServer(t)
+	defer httpSrv.Close()
+	target := createTestSource(httpSrv, testdata.MediumFileName)
+	redirectSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/local":
+			http.Redirect(rw, req, strings.Replace(target, "127.0.0.1", "localhost", 1), http.StatusFound)
+		case "/twice":
+			http.Redirect(rw, req, "/once", http.StatusFound)
+		case "/once":
+			http.Redirect(rw, req, target, http.StatusFound)
+		case "/scheme":
+			http.Redirect(rw, req, "file:///etc/passwd", http.StatusFound)
+		}
+	}))
+	defer redirectSrv.Close()
+	allowNets, err := ParseCIDRs("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		HostPolicy: &HostPolicy{
+			DenyHosts:     []string{"localhost"},
+			AllowNetworks: allowNets,
+		},
+		MaxRedirects: 1,
+	}
+	_, err = srv.Get(imageserver.Params{imageserver.SourceParam: redirectSrv.URL + "/once"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/local", "/twice", "/scheme"} {
+		_, err = srv.Get(imageserver.Params{imageserver.SourceParam: redirectSrv.URL + path})
+		if _, ok := err.(*imageserver.ParamError); !ok {
+			t.Fatalf("unexpected error for path %s: %v", path, err)
+		}
+	}
+	srv = &Server{
+		MaxRedirects: -1,
+	}
+	_, err = srv.Get(imageserver.Params{imageserver.SourceParam: redirectSrv.URL + "/once"})
+	if _, ok := err.(*imageserver.ParamError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
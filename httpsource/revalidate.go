@@ -0,0 +1,198 @@
+package httpsource
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+)
+
+// Metadata keys set by Server in the Image metadata.
+const (
+	// MetadataETag contains the "ETag" header of the response.
+	MetadataETag = "http_etag"
+	// MetadataLastModified contains the "Last-Modified" header of the response.
+	MetadataLastModified = "http_last_modified"
+	// MetadataMaxAge contains the "max-age" directive (in seconds) of the "Cache-Control" header of the response.
+	// It is "0" if the response must be revalidated ("no-cache", "no-store" or "must-revalidate" without "max-age").
+	MetadataMaxAge = "http_max_age"
+	// MetadataFetched contains the Unix time (in seconds) of the last download or revalidation.
+	MetadataFetched = "http_fetched"
+)
+
+// Revalidate checks with a conditional request if a cached Image, previously returned by the Server, is still valid.
+//
+// It sends the "If-None-Match" and "If-Modified-Since" headers from the cached Image metadata.
+// If the origin returns a StatusNotModified/304 response, it returns a new Image that shares the data of the cached Image, with updated metadata.
+// Otherwise, it returns the downloaded Image.
+func (srv *Server) Revalidate(ctx context.Context, params imageserver.Params, cached *imageserver.Image) (*imageserver.Image, error) {
+	return srv.get(ctx, params, cached)
+}
+
+// HeuristicFreshnessFraction is the fraction of the Last-Modified age used as heuristic freshness lifetime (10%).
+//
+// See https://tools.ietf.org/html/rfc7234#section-4.2.2 .
+const HeuristicFreshnessFraction = 0.1
+
+// IsFresh returns true if the Image returned by Server is still fresh at the given time (see GetFreshnessLifetime).
+//
+// defaultMaxAge is used if the response has no freshness information.
+// It returns false if the fetch time is missing.
+func IsFresh(im *imageserver.Image, now time.Time, defaultMaxAge time.Duration) bool {
+	fetched, err := strconv.ParseInt(im.Metadata[MetadataFetched], 10, 64)
+	if err != nil {
+		return false
+	}
+	return now.Before(time.Unix(fetched, 0).Add(GetFreshnessLifetime(im, defaultMaxAge)))
+}
+
+// GetFreshnessLifetime returns the freshness lifetime of the Image returned by Server.
+//
+// It is:
+//  - the max-age of the response, if it is set (it can be 0, see MetadataMaxAge)
+//  - a heuristic lifetime, if the response has a Last-Modified value: HeuristicFreshnessFraction of the time between it and the fetch time
+//  - defaultMaxAge otherwise
+func GetFreshnessLifetime(im *imageserver.Image, defaultMaxAge time.Duration) time.Duration {
+	if maxAge, err := strconv.ParseInt(im.Metadata[MetadataMaxAge], 10, 64); err == nil {
+		return time.Duration(maxAge) * time.Second
+	}
+	fetched, err := strconv.ParseInt(im.Metadata[MetadataFetched], 10, 64)
+	if err == nil && im.Metadata[MetadataLastModified] != "" {
+		lastModified, err := http.ParseTime(im.Metadata[MetadataLastModified])
+		if err == nil {
+			age := time.Unix(fetched, 0).Sub(lastModified)
+			if age > 0 {
+				return time.Duration(float64(age) * HeuristicFreshnessFraction)
+			}
+		}
+	}
+	return defaultMaxAge
+}
+
+// HasValidators returns true if the Image returned by Server has an ETag or a Last-Modified value.
+func HasValidators(im *imageserver.Image) bool {
+	return im.Metadata[MetadataETag] != "" || im.Metadata[MetadataLastModified] != ""
+}
+
+func setConditionalHeaders(req *http.Request, cached *imageserver.Image) {
+	if etag := cached.Metadata[MetadataETag]; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Metadata[MetadataLastModified]; lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+func getResponseMetadata(response *http.Response) map[string]string {
+	metadata := map[string]string{
+		MetadataFetched: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if etag := response.Header.Get("ETag"); etag != "" {
+		metadata[MetadataETag] = etag
+	}
+	if lastModified := response.Header.Get("Last-Modified"); lastModified != "" {
+		metadata[MetadataLastModified] = lastModified
+	}
+	if maxAge, ok := parseMaxAge(response.Header.Get("Cache-Control")); ok {
+		metadata[MetadataMaxAge] = strconv.Itoa(maxAge)
+	}
+	return metadata
+}
+
+func newRevalidatedImage(cached *imageserver.Image, response *http.Response) *imageserver.Image {
+	metadata := make(map[string]string, len(cached.Metadata))
+	for k, v := range cached.Metadata {
+		metadata[k] = v
+	}
+	// A 304 response can update the validators and the freshness.
+	for k, v := range getResponseMetadata(response) {
+		metadata[k] = v
+	}
+	return &imageserver.Image{
+		Format:   cached.Format,
+		Data:     cached.Data,
+		Metadata: metadata,
+	}
+}
+
+func parseMaxAge(cacheControl string) (int, bool) {
+	if cacheControl == "" {
+		return 0, false
+	}
+	maxAge := -1
+	revalidate := false
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0, true
+		case directive == "must-revalidate":
+			revalidate = true
+		case strings.HasPrefix(directive, "max-age="):
+			v, err := strconv.Atoi(strings.Trim(directive[len("max-age="):], "\""))
+			if err == nil && v >= 0 {
+				maxAge = v
+			}
+		}
+	}
+	if maxAge >= 0 {
+		return maxAge, true
+	}
+	if revalidate {
+		return 0, true
+	}
+	return 0, false
+}
+
+// RevalidationServer is a imageserver.Server implementation that caches the Images returned by Server, and revalidates them with the origin.
+//
+// Steps:
+//  - Get the Image from the Cache.
+//  - If it is fresh (see IsFresh, with DefaultMaxAge), return it.
+//  - If it has validators (see HasValidators), revalidate it (see Server.Revalidate). Otherwise, download it.
+//  - Set the Image to the Cache, and return it.
+//
+// It should be used with only the "source" param (see imageserver.SourceServer), because it calls Server directly.
+type RevalidationServer struct {
+	Server       *Server
+	Cache        imageserver_cache.Cache
+	KeyGenerator imageserver_cache.KeyGenerator
+
+	// DefaultMaxAge is the freshness lifetime of the responses without "Cache-Control" max-age and "Last-Modified".
+	// If it is 0 (default), they are revalidated (or downloaded) on each call.
+	DefaultMaxAge time.Duration
+}
+
+// Get implements imageserver.Server.
+func (srv *RevalidationServer) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (srv *RevalidationServer) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	key := srv.KeyGenerator.GetKey(params)
+	im, err := imageserver_cache.GetWithContext(ctx, srv.Cache, key, params)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case im != nil && IsFresh(im, time.Now(), srv.DefaultMaxAge):
+		return im, nil
+	case im != nil && HasValidators(im):
+		im, err = srv.Server.Revalidate(ctx, params, im)
+	default:
+		im, err = srv.Server.GetContext(ctx, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = imageserver_cache.SetWithContext(ctx, srv.Cache, key, im, params)
+	if err != nil {
+		return nil, err
+	}
+	return im, nil
+}
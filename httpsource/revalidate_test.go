@@ -0,0 +1,261 @@
+package httpsource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	imageserver_cache "github.com/pierrre/imageserver/cache"
+	cachetest "github.com/pierrre/imageserver/cache/_test"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+type testOrigin struct {
+	*httptest.Server
+	etag         atomic.Value
+	cacheControl string
+	requests     int32
+	notModified  int32
+}
+
+func newTestOrigin(cacheControl string) *testOrigin {
+	o := &testOrigin{cacheControl: cacheControl}
+	o.etag.Store("\"v1\"")
+	o.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&o.requests, 1)
+		etag := o.etag.Load().(string)
+		rw.Header().Set("ETag", etag)
+		rw.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if o.cacheControl != "" {
+			rw.Header().Set("Cache-Control", o.cacheControl)
+		}
+		if req.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&o.notModified, 1)
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Header().Set("Content-Type", "image/jpeg")
+		rw.Write(testdata.Medium.Data)
+	}))
+	return o
+}
+
+func TestGetMetadata(t *testing.T) {
+	o := newTestOrigin("public, max-age=60")
+	defer o.Close()
+	srv := &Server{}
+	im, err := srv.Get(imageserver.Params{imageserver.SourceParam: o.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		MetadataETag:         "\"v1\"",
+		MetadataLastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+		MetadataMaxAge:       "60",
+	} {
+		if got := im.Metadata[k]; got != want {
+			t.Fatalf("unexpected metadata \"%s\": got \"%s\", want \"%s\"", k, got, want)
+		}
+	}
+	if !IsFresh(im, time.Now(), 0) {
+		t.Fatal("not fresh")
+	}
+	if IsFresh(im, time.Now().Add(2*time.Minute), 0) {
+		t.Fatal("fresh")
+	}
+	if !HasValidators(im) {
+		t.Fatal("no validators")
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	o := newTestOrigin("")
+	defer o.Close()
+	srv := &Server{}
+	params := imageserver.Params{imageserver.SourceParam: o.URL}
+	im1, err := srv.Get(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im2, err := srv.Revalidate(context.Background(), params, im1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.notModified != 1 {
+		t.Fatal("not revalidated")
+	}
+	if !imageserver.ImageEqual(im1, im2) {
+		t.Fatal("not equal")
+	}
+	o.etag.Store("\"v2\"")
+	im3, err := srv.Revalidate(context.Background(), params, im2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.notModified != 1 {
+		t.Fatal("unexpected 304")
+	}
+	if im3.Metadata[MetadataETag] != "\"v2\"" {
+		t.Fatalf("unexpected etag: %s", im3.Metadata[MetadataETag])
+	}
+}
+
+func TestParseMaxAge(t *testing.T) {
+	for _, tc := range []struct {
+		cacheControl string
+		maxAge       int
+		ok           bool
+	}{
+		{"", 0, false},
+		{"public", 0, false},
+		{"public, max-age=60", 60, true},
+		{"Max-Age=\"30\"", 30, true},
+		{"max-age=foo", 0, false},
+		{"no-cache", 0, true},
+		{"no-store, max-age=60", 0, true},
+		{"must-revalidate", 0, true},
+		{"must-revalidate, max-age=10", 10, true},
+	} {
+		maxAge, ok := parseMaxAge(tc.cacheControl)
+		if maxAge != tc.maxAge || ok != tc.ok {
+			t.Fatalf("unexpected result for \"%s\": got %d %t, want %d %t", tc.cacheControl, maxAge, ok, tc.maxAge, tc.ok)
+		}
+	}
+}
+
+var _ imageserver.ContextServer = &RevalidationServer{}
+
+func TestRevalidationServer(t *testing.T) {
+	for _, tc := range []struct {
+		cacheControl        string
+		expectedRequests    int32
+		expectedNotModified int32
+	}{
+		{"max-age=60", 1, 0},
+		{"no-cache", 3, 2},
+		// Heuristic freshness from Last-Modified.
+		{"", 1, 0},
+	} {
+		func() {
+			o := newTestOrigin(tc.cacheControl)
+			defer o.Close()
+			srv := &RevalidationServer{
+				Server: &Server{},
+				Cache:  cachetest.NewMapCache(),
+				KeyGenerator: imageserver_cache.KeyGeneratorFunc(func(params imageserver.Params) string {
+					return params.String()
+				}),
+			}
+			params := imageserver.Params{imageserver.SourceParam: o.URL}
+			for i := 0; i < 3; i++ {
+				im, err := srv.Get(params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !imageserver.ImageEqual(im, testdata.Medium) {
+					t.Fatal("not equal")
+				}
+			}
+			if o.requests != tc.expectedRequests || o.notModified != tc.expectedNotModified {
+				t.Fatalf("unexpected requests for \"%s\": got %d/%d, want %d/%d", tc.cacheControl, o.requests, o.notModified, tc.expectedRequests, tc.expectedNotModified)
+			}
+		}()
+	}
+}
+
+func TestGetFreshnessLifetime(t *testing.T) {
+	fetched := time.Date(2016, 1, 11, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		metadata map[string]string
+		expected time.Duration
+	}{
+		{
+			metadata: map[string]string{MetadataMaxAge: "60", MetadataLastModified: "Fri, 01 Jan 2016 00:00:00 GMT"},
+			expected: time.Minute,
+		},
+		{
+			metadata: map[string]string{MetadataMaxAge: "0"},
+			expected: 0,
+		},
+		{
+			metadata: map[string]string{MetadataLastModified: "Fri, 01 Jan 2016 00:00:00 GMT"},
+			expected: 24 * time.Hour,
+		},
+		{
+			metadata: map[string]string{MetadataLastModified: "invalid"},
+			expected: time.Hour,
+		},
+		{
+			metadata: map[string]string{},
+			expected: time.Hour,
+		},
+	} {
+		tc.metadata[MetadataFetched] = strconv.FormatInt(fetched.Unix(), 10)
+		lifetime := GetFreshnessLifetime(&imageserver.Image{Metadata: tc.metadata}, time.Hour)
+		if lifetime != tc.expected {
+			t.Fatalf("unexpected lifetime for %v: got %s, want %s", tc.metadata, lifetime, tc.expected)
+		}
+	}
+}
+
+func TestRevalidationServerNoCacheControl(t *testing.T) {
+	var requests int32
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.Write(testdata.Medium.Data)
+	}))
+	defer httpSrv.Close()
+	srv := &RevalidationServer{
+		Server: &Server{},
+		Cache:  cachetest.NewMapCache(),
+		KeyGenerator: imageserver_cache.KeyGeneratorFunc(func(params imageserver.Params) string {
+			return params.String()
+		}),
+		DefaultMaxAge: time.Minute,
+	}
+	params := imageserver.Params{imageserver.SourceParam: httpSrv.URL}
+	for i := 0; i < 3; i++ {
+		_, err := srv.Get(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("unexpected requests: got %d, want %d", requests, 1)
+	}
+}
+
+func TestRevalidationServerNoValidators(t *testing.T) {
+	var requests int32
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+			t.Error("unexpected conditional request")
+		}
+		rw.Header().Set("Content-Length", strconv.Itoa(len(testdata.Medium.Data)))
+		rw.Write(testdata.Medium.Data)
+	}))
+	defer httpSrv.Close()
+	srv := &RevalidationServer{
+		Server: &Server{},
+		Cache:  cachetest.NewMapCache(),
+		KeyGenerator: imageserver_cache.KeyGeneratorFunc(func(params imageserver.Params) string {
+			return params.String()
+		}),
+	}
+	params := imageserver.Params{imageserver.SourceParam: httpSrv.URL}
+	for i := 0; i < 2; i++ {
+		_, err := srv.Get(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 2 {
+		t.Fatalf("unexpected requests: got %d, want %d", requests, 2)
+	}
+}
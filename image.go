@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
 )
 
 const (
@@ -11,6 +12,10 @@ const (
 	ImageFormatMaxLen = 1 << 8 // 256 B
 	// ImageDataMaxLen is the maximum length for the Mmage's data.
 	ImageDataMaxLen = 1 << 30 // 1 GiB
+	// ImageMetadataMaxLen is the maximum number of entries in the Image's metadata.
+	ImageMetadataMaxLen = 1 << 8 // 256
+	// ImageMetadataValueMaxLen is the maximum length for a key or a value of the Image's metadata.
+	ImageMetadataValueMaxLen = 1 << 16 // 64 KiB
 )
 
 var (
@@ -24,7 +29,12 @@ var (
 //  - Format (string)
 //  - Data length (uint32)
 //  - Data([]byte)
+//  - Metadata (only if it is not empty):
+//    - Entries count (uint32)
+//    - For each entry (sorted by key): key length (uint32), key (string), value length (uint32), value (string)
 // Numbers are encoded using little-endian order.
+//
+// The metadata is encoded after the data, so an Image encoded without metadata can still be decoded, and the metadata is ignored by older decoders.
 type Image struct {
 	// Format is the format used to encode the image.
 	//
@@ -33,6 +43,11 @@ type Image struct {
 
 	// Data contains the raw data of the encoded image.
 	Data []byte
+
+	// Metadata contains optional information about the Image (e.g. HTTP validators of the source).
+	// It is not part of the image content, and is ignored by ImageEqual.
+	// It should not be modified after the Image is returned by a Server.
+	Metadata map[string]string
 }
 
 // MarshalBinary implements encoding.BinaryMarshaler.
@@ -44,7 +59,18 @@ func (im *Image) MarshalBinary() ([]byte, error) {
 		return nil, &ImageError{Message: fmt.Sprintf("marshal: data length %d is greater than the maximum value %d", len(im.Data), ImageDataMaxLen)}
 	}
 
-	data := make([]byte, 0, 4+len(im.Format)+4+len(im.Data))
+	if len(im.Metadata) > ImageMetadataMaxLen {
+		return nil, &ImageError{Message: fmt.Sprintf("marshal: metadata length %d is greater than the maximum value %d", len(im.Metadata), ImageMetadataMaxLen)}
+	}
+	metadataLen := 0
+	for k, v := range im.Metadata {
+		if len(k) > ImageMetadataValueMaxLen || len(v) > ImageMetadataValueMaxLen {
+			return nil, &ImageError{Message: fmt.Sprintf("marshal: metadata \"%.32s\" length is greater than the maximum value %d", k, ImageMetadataValueMaxLen)}
+		}
+		metadataLen += 4 + len(k) + 4 + len(v)
+	}
+
+	data := make([]byte, 0, 4+len(im.Format)+4+len(im.Data)+4+metadataLen)
 	buf := make([]byte, 4)
 
 	imageByteOrder.PutUint32(buf, uint32(len(im.Format)))
@@ -55,6 +81,24 @@ func (im *Image) MarshalBinary() ([]byte, error) {
 	data = append(data, buf...)
 	data = append(data, im.Data...)
 
+	if len(im.Metadata) == 0 {
+		return data, nil
+	}
+	keys := make([]string, 0, len(im.Metadata))
+	for k := range im.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	imageByteOrder.PutUint32(buf, uint32(len(keys)))
+	data = append(data, buf...)
+	for _, k := range keys {
+		for _, s := range []string{k, im.Metadata[k]} {
+			imageByteOrder.PutUint32(buf, uint32(len(s)))
+			data = append(data, buf...)
+			data = append(data, s...)
+		}
+	}
+
 	return data, nil
 }
 
@@ -113,6 +157,39 @@ func (im *Image) UnmarshalBinaryNoCopy(data []byte) error {
 	}
 	im.Data = buf
 
+	im.Metadata = nil
+	if len(data) == 0 {
+		return nil
+	}
+	buf, err = readData(4)
+	if err != nil {
+		return err
+	}
+	metadataLen := imageByteOrder.Uint32(buf)
+	if metadataLen > ImageMetadataMaxLen {
+		return &ImageError{Message: fmt.Sprintf("unmarshal: metadata length %d is greater than the maximum value %d", metadataLen, ImageMetadataMaxLen)}
+	}
+	im.Metadata = make(map[string]string, metadataLen)
+	for i := uint32(0); i < metadataLen; i++ {
+		var kv [2]string
+		for j := range kv {
+			buf, err = readData(4)
+			if err != nil {
+				return err
+			}
+			l := imageByteOrder.Uint32(buf)
+			if l > ImageMetadataValueMaxLen {
+				return &ImageError{Message: fmt.Sprintf("unmarshal: metadata length %d is greater than the maximum value %d", l, ImageMetadataValueMaxLen)}
+			}
+			buf, err = readData(int(l))
+			if err != nil {
+				return err
+			}
+			kv[j] = string(buf)
+		}
+		im.Metadata[kv[0]] = kv[1]
+	}
+
 	return nil
 }
 
@@ -0,0 +1,85 @@
+package image
+
+import (
+	"context"
+	"image"
+	"sync"
+
+	"github.com/pierrre/imageserver"
+)
+
+// BatchHandler processes several variants of the same Image.
+//
+// The Image is decoded once, then each variant is processed by the Processor (optional) and encoded, like Handler.
+// The variants are processed concurrently, and the total number of concurrent executions (for all calls) is limited.
+type BatchHandler struct {
+	Processor Processor
+
+	limitCh chan struct{}
+}
+
+// NewBatchHandler creates a new BatchHandler.
+//
+// limit is the maximum number of variants processed concurrently, for all calls.
+func NewBatchHandler(prc Processor, limit int) *BatchHandler {
+	return &BatchHandler{
+		Processor: prc,
+		limitCh:   make(chan struct{}, limit),
+	}
+}
+
+// BatchResult is the result of a variant.
+type BatchResult struct {
+	Image *imageserver.Image
+	Err   error
+}
+
+// HandleBatch processes the variants of the Image.
+//
+// It returns a BatchResult for each Params, in the same order.
+// If a variant fails, its error is returned in the BatchResult, and the other variants are not affected.
+// If the context is done, the remaining variants return the context error.
+func (hdr *BatchHandler) HandleBatch(ctx context.Context, im *imageserver.Image, paramsList []imageserver.Params) []*BatchResult {
+	d := &batchDecoder{im: im}
+	results := make([]*BatchResult, len(paramsList))
+	wg := new(sync.WaitGroup)
+	for i, params := range paramsList {
+		results[i] = new(BatchResult)
+		wg.Add(1)
+		go func(res *BatchResult, params imageserver.Params) {
+			defer wg.Done()
+			res.Image, res.Err = hdr.handle(ctx, d, im, params)
+		}(results[i], params)
+	}
+	wg.Wait()
+	return results
+}
+
+func (hdr *BatchHandler) handle(ctx context.Context, d *batchDecoder, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	select {
+	case hdr.limitCh <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		<-hdr.limitCh
+	}()
+	return handle(ctx, hdr.Processor, im, params, d.decode)
+}
+
+// batchDecoder decodes the Image once, and shares the result.
+//
+// The decoded Image must not be modified (Processors return a new Image).
+type batchDecoder struct {
+	im   *imageserver.Image
+	once sync.Once
+	nim  image.Image
+	err  error
+}
+
+func (d *batchDecoder) decode() (image.Image, error) {
+	d.once.Do(func() {
+		d.nim, d.err = Decode(d.im)
+	})
+	return d.nim, d.err
+}
@@ -0,0 +1,123 @@
+package image
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestBatchHandler(t *testing.T) {
+	var mu sync.Mutex
+	decoded := make(map[image.Image]bool)
+	hdr := NewBatchHandler(ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+		mu.Lock()
+		decoded[nim] = true
+		mu.Unlock()
+		if params.Has("error") {
+			return nil, &imageserver.ParamError{Param: "error", Message: "error"}
+		}
+		return nim, nil
+	}), 2)
+	results := hdr.HandleBatch(context.Background(), testdata.Medium, []imageserver.Params{
+		{"quality": 50},
+		{"quality": 60},
+		{"quality": 70, "error": true},
+		{"quality": 9001},
+		{},
+	})
+	if len(results) != 5 {
+		t.Fatalf("unexpected results count: %d", len(results))
+	}
+	for i := 0; i < 2; i++ {
+		if results[i].Err != nil {
+			t.Fatal(results[i].Err)
+		}
+		if results[i].Image.Format != "jpeg" {
+			t.Fatalf("unexpected format: %s", results[i].Image.Format)
+		}
+	}
+	if len(results[0].Image.Data) == len(results[1].Image.Data) {
+		t.Fatal("variants are equal")
+	}
+	for _, i := range []int{2, 3} {
+		if _, ok := results[i].Err.(*imageserver.ParamError); !ok {
+			t.Fatalf("unexpected error for variant %d: %v", i, results[i].Err)
+		}
+	}
+	if results[4].Err != nil {
+		t.Fatal(results[4].Err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("the Image was decoded %d times", len(decoded))
+	}
+}
+
+func TestBatchHandlerNoChange(t *testing.T) {
+	hdr := NewBatchHandler(nil, 1)
+	results := hdr.HandleBatch(context.Background(), testdata.Medium, []imageserver.Params{{}})
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if results[0].Image != testdata.Medium {
+		t.Fatal("not equal")
+	}
+}
+
+func TestBatchHandlerErrorDecode(t *testing.T) {
+	hdr := NewBatchHandler(nil, 1)
+	results := hdr.HandleBatch(context.Background(), testdata.Invalid, []imageserver.Params{
+		{"format": "jpeg"},
+		{"format": "jpeg", "quality": 50},
+	})
+	for _, res := range results {
+		if _, ok := res.Err.(*imageserver.ImageError); !ok {
+			t.Fatalf("unexpected error: %v", res.Err)
+		}
+	}
+}
+
+func TestBatchHandlerLimit(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	hdr := NewBatchHandler(ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		return nim, nil
+	}), 2)
+	var paramsList []imageserver.Params
+	for i := 0; i < 10; i++ {
+		paramsList = append(paramsList, imageserver.Params{"quality": 50 + i})
+	}
+	for _, res := range hdr.HandleBatch(context.Background(), testdata.Small, paramsList) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	if maxRunning > 2 {
+		t.Fatalf("too many concurrent executions: %d", maxRunning)
+	}
+}
+
+func TestBatchHandlerContextCanceled(t *testing.T) {
+	hdr := NewBatchHandler(nil, 1)
+	hdr.limitCh <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := hdr.HandleBatch(ctx, testdata.Medium, []imageserver.Params{{"quality": 50}})
+	if results[0].Err != context.Canceled {
+		t.Fatalf("unexpected error: %v", results[0].Err)
+	}
+}
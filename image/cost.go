@@ -0,0 +1,238 @@
+package image
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"image"
+	"sync"
+
+	"github.com/pierrre/imageserver"
+)
+
+// CostFunc returns the estimated cost for handling an Image with the given Params.
+type CostFunc func(*imageserver.Image, imageserver.Params) (int64, error)
+
+// ResizeParams contains the names of the params used by PixelCost to get the output size.
+//
+// Each param must be a Params node containing optional "width" and "height" int values.
+var ResizeParams = []string{"gift_resize", "nfntresize", "graphicsmagick"}
+
+// MaxCostDimension is the maximum dimension (width or height) used by PixelCost.
+//
+// Larger values (e.g. from a client) are clamped, so the cost can not overflow.
+const MaxCostDimension = 1 << 20
+
+// PixelCost is a CostFunc that returns the number of pixels of the source Image plus the number of pixels of the output Image.
+//
+// The source dimensions are read with image.DecodeConfig(), so only the header is decoded.
+// If the format is not supported, the source is not counted.
+//
+// The output dimensions come from the first param of ResizeParams that is set.
+// If only one dimension is set, the other one is computed from the source aspect ratio.
+// If no dimension is set, the output has the same size as the source.
+func PixelCost(im *imageserver.Image, params imageserver.Params) (int64, error) {
+	var srcW, srcH int64
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(im.Data))
+	if err == nil {
+		srcW, srcH = clampCostDimension(int64(cfg.Width)), clampCostDimension(int64(cfg.Height))
+	}
+	outW, outH, err := getCostOutputSize(srcW, srcH, params)
+	if err != nil {
+		return 0, err
+	}
+	return srcW*srcH + outW*outH, nil
+}
+
+func getCostOutputSize(srcW, srcH int64, params imageserver.Params) (int64, int64, error) {
+	for _, name := range ResizeParams {
+		if !params.Has(name) {
+			continue
+		}
+		resizeParams, err := params.GetParams(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		w, err := getCostDimension(name, "width", resizeParams)
+		if err != nil {
+			return 0, 0, err
+		}
+		h, err := getCostDimension(name, "height", resizeParams)
+		if err != nil {
+			return 0, 0, err
+		}
+		switch {
+		case w != 0 && h != 0:
+			return w, h, nil
+		case w != 0:
+			return w, scaleDimension(srcH, w, srcW), nil
+		case h != 0:
+			return scaleDimension(srcW, h, srcH), h, nil
+		}
+		return srcW, srcH, nil
+	}
+	return srcW, srcH, nil
+}
+
+func getCostDimension(name string, dimension string, params imageserver.Params) (int64, error) {
+	if !params.Has(dimension) {
+		return 0, nil
+	}
+	v, err := params.GetInt(dimension)
+	if err != nil {
+		if err, ok := err.(*imageserver.ParamError); ok {
+			err.Param = name + "." + err.Param
+		}
+		return 0, err
+	}
+	if v < 0 {
+		return 0, &imageserver.ParamError{Param: name + "." + dimension, Message: "must be greater than or equal to 0"}
+	}
+	return clampCostDimension(int64(v)), nil
+}
+
+func clampCostDimension(v int64) int64 {
+	if v > MaxCostDimension {
+		return MaxCostDimension
+	}
+	return v
+}
+
+// scaleDimension returns v * num / den (clamped), or num if den is 0.
+//
+// The values must be clamped, so the multiplication can not overflow.
+func scaleDimension(v, num, den int64) int64 {
+	if den == 0 {
+		return num
+	}
+	return clampCostDimension(v * num / den)
+}
+
+// CostLimitHandler is a imageserver.Handler implementation that limits the total cost of concurrent executions.
+//
+// Each call is charged the cost returned by CostFunc, and waits until enough budget is free.
+// Calls are served in order, so an expensive call is not starved by cheaper ones.
+// A call with a cost greater than the budget, or lower than or equal to 0, is charged the whole budget.
+//
+// If the Handler is called with a context.Context, it stops waiting when the context is done.
+type CostLimitHandler struct {
+	imageserver.Handler
+
+	// CostFunc is an optional CostFunc.
+	// PixelCost is used by default, and the budget is a number of pixels.
+	CostFunc CostFunc
+
+	budget  int64
+	mu      sync.Mutex
+	used    int64
+	waiters *list.List
+}
+
+type costWaiter struct {
+	cost  int64
+	ready chan struct{}
+}
+
+// NewCostLimitHandler creates a new CostLimitHandler.
+//
+// budget is the maximum total cost of concurrent executions.
+func NewCostLimitHandler(hdr imageserver.Handler, budget int64) *CostLimitHandler {
+	return &CostLimitHandler{
+		Handler: hdr,
+		budget:  budget,
+		waiters: list.New(),
+	}
+}
+
+// Handle implements imageserver.Handler.
+func (hdr *CostLimitHandler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *CostLimitHandler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	costFunc := hdr.CostFunc
+	if costFunc == nil {
+		costFunc = PixelCost
+	}
+	cost, err := costFunc(im, params)
+	if err != nil {
+		return nil, err
+	}
+	if cost <= 0 || cost > hdr.budget {
+		// An invalid cost must not increase the free budget.
+		cost = hdr.budget
+	}
+	err = hdr.acquire(ctx, cost)
+	if err != nil {
+		return nil, err
+	}
+	defer hdr.release(cost)
+	return imageserver.HandleWithContext(ctx, hdr.Handler, im, params)
+}
+
+func (hdr *CostLimitHandler) acquire(ctx context.Context, cost int64) error {
+	hdr.mu.Lock()
+	if hdr.waiters.Len() == 0 && hdr.used+cost <= hdr.budget {
+		hdr.used += cost
+		hdr.mu.Unlock()
+		return nil
+	}
+	w := &costWaiter{
+		cost:  cost,
+		ready: make(chan struct{}),
+	}
+	e := hdr.waiters.PushBack(w)
+	hdr.mu.Unlock()
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		hdr.mu.Lock()
+		defer hdr.mu.Unlock()
+		select {
+		case <-w.ready:
+			// The budget was granted in the meantime.
+			hdr.used -= cost
+		default:
+			hdr.waiters.Remove(e)
+		}
+		hdr.notifyWaiters()
+		return ctx.Err()
+	}
+}
+
+func (hdr *CostLimitHandler) release(cost int64) {
+	hdr.mu.Lock()
+	defer hdr.mu.Unlock()
+	hdr.used -= cost
+	hdr.notifyWaiters()
+}
+
+// notifyWaiters grants the budget to the waiters, in order.
+//
+// It must be called with the lock held.
+func (hdr *CostLimitHandler) notifyWaiters() {
+	for {
+		e := hdr.waiters.Front()
+		if e == nil {
+			return
+		}
+		w := e.Value.(*costWaiter)
+		if hdr.used+w.cost > hdr.budget {
+			return
+		}
+		hdr.used += w.cost
+		hdr.waiters.Remove(e)
+		close(w.ready)
+	}
+}
+
+// Used returns the cost currently used.
+//
+// It can be used for monitoring.
+func (hdr *CostLimitHandler) Used() int64 {
+	hdr.mu.Lock()
+	defer hdr.mu.Unlock()
+	return hdr.used
+}
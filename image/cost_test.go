@@ -0,0 +1,214 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestPixelCost(t *testing.T) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(testdata.Medium.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := int64(cfg.Width * cfg.Height)
+	for _, tc := range []struct {
+		params   imageserver.Params
+		expected int64
+	}{
+		{
+			params:   imageserver.Params{},
+			expected: src * 2,
+		},
+		{
+			params: imageserver.Params{"gift_resize": imageserver.Params{
+				"width":  100,
+				"height": 50,
+			}},
+			expected: src + 100*50,
+		},
+		{
+			params: imageserver.Params{"nfntresize": imageserver.Params{
+				"width": 100,
+			}},
+			expected: src + 100*int64(cfg.Height*100/cfg.Width),
+		},
+		{
+			params: imageserver.Params{"graphicsmagick": imageserver.Params{
+				"height": 100,
+			}},
+			expected: src + int64(cfg.Width*100/cfg.Height)*100,
+		},
+	} {
+		cost, err := PixelCost(testdata.Medium, tc.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost != tc.expected {
+			t.Fatalf("unexpected cost for %s: got %d, want %d", tc.params, cost, tc.expected)
+		}
+	}
+}
+
+func TestPixelCostUnsupportedFormat(t *testing.T) {
+	cost, err := PixelCost(&imageserver.Image{Format: "foo", Data: []byte("foo")}, imageserver.Params{
+		"gift_resize": imageserver.Params{"width": 10, "height": 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost != 100 {
+		t.Fatalf("unexpected cost: got %d, want %d", cost, 100)
+	}
+}
+
+func TestPixelCostError(t *testing.T) {
+	for _, params := range []imageserver.Params{
+		{"gift_resize": "foo"},
+		{"gift_resize": imageserver.Params{"width": "foo"}},
+		{"gift_resize": imageserver.Params{"height": -1}},
+	} {
+		_, err := PixelCost(testdata.Medium, params)
+		if _, ok := err.(*imageserver.ParamError); !ok {
+			t.Fatalf("unexpected error for %s: %v", params, err)
+		}
+	}
+}
+
+func TestPixelCostOverflow(t *testing.T) {
+	for _, params := range []imageserver.Params{
+		{"gift_resize": imageserver.Params{"width": 4611686018427387904, "height": 2}},
+		{"gift_resize": imageserver.Params{"width": 4611686018427387904}},
+		{"gift_resize": imageserver.Params{"height": 4611686018427387904}},
+	} {
+		cost, err := PixelCost(testdata.Medium, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost <= 0 || cost > 2*MaxCostDimension*MaxCostDimension {
+			t.Fatalf("unexpected cost for %s: %d", params, cost)
+		}
+	}
+}
+
+var _ imageserver.ContextHandler = &CostLimitHandler{}
+
+func TestCostLimitHandler(t *testing.T) {
+	started := make(chan struct{}, 2)
+	block := make(chan struct{})
+	hdr := NewCostLimitHandler(imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+		started <- struct{}{}
+		<-block
+		return im, nil
+	}), 10)
+	hdr.CostFunc = func(im *imageserver.Image, params imageserver.Params) (int64, error) {
+		cost, err := params.GetInt("cost")
+		return int64(cost), err
+	}
+	done := make(chan error, 3)
+	handle := func(cost int) {
+		go func() {
+			_, err := hdr.Handle(&imageserver.Image{}, imageserver.Params{"cost": cost})
+			done <- err
+		}()
+	}
+	handle(6)
+	<-started
+	handle(6)
+	waitCostUsed(t, hdr, 6, 1)
+	handle(1)
+	waitCostUsed(t, hdr, 6, 2)
+	close(block)
+	for i := 0; i < 3; i++ {
+		err := <-done
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if used := hdr.Used(); used != 0 {
+		t.Fatalf("unexpected used cost: got %d, want %d", used, 0)
+	}
+}
+
+func TestCostLimitHandlerCostGreaterThanBudget(t *testing.T) {
+	hdr := NewCostLimitHandler(imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+		return im, nil
+	}), 10)
+	hdr.CostFunc = func(im *imageserver.Image, params imageserver.Params) (int64, error) {
+		return 100, nil
+	}
+	_, err := hdr.Handle(&imageserver.Image{}, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCostLimitHandlerCostInvalid(t *testing.T) {
+	for _, c := range []int64{0, -100} {
+		var hdr *CostLimitHandler
+		hdr = NewCostLimitHandler(imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+			if used := hdr.Used(); used != 10 {
+				t.Fatalf("unexpected used cost for %d: got %d, want %d", c, used, 10)
+			}
+			return im, nil
+		}), 10)
+		hdr.CostFunc = func(im *imageserver.Image, params imageserver.Params) (int64, error) {
+			return c, nil
+		}
+		_, err := hdr.Handle(&imageserver.Image{}, imageserver.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used := hdr.Used(); used != 0 {
+			t.Fatalf("unexpected used cost: got %d, want %d", used, 0)
+		}
+	}
+}
+
+func TestCostLimitHandlerContextCanceled(t *testing.T) {
+	block := make(chan struct{})
+	hdr := NewCostLimitHandler(imageserver.HandlerFunc(func(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+		<-block
+		return im, nil
+	}), 10)
+	hdr.CostFunc = func(im *imageserver.Image, params imageserver.Params) (int64, error) {
+		return 10, nil
+	}
+	defer close(block)
+	go hdr.Handle(&imageserver.Image{}, imageserver.Params{})
+	waitCostUsed(t, hdr, 10, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := hdr.HandleContext(ctx, &imageserver.Image{}, imageserver.Params{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitCostUsed(t, hdr, 10, 0)
+}
+
+func TestCostLimitHandlerErrorCost(t *testing.T) {
+	hdr := NewCostLimitHandler(nil, 10)
+	_, err := hdr.Handle(testdata.Medium, imageserver.Params{"gift_resize": "foo"})
+	if err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func waitCostUsed(t *testing.T, hdr *CostLimitHandler, used int64, waiters int) {
+	for i := 0; i < 1000; i++ {
+		hdr.mu.Lock()
+		ok := hdr.used == used && hdr.waiters.Len() == waiters
+		hdr.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	t.Fatal("timeout while waiting for cost")
+}
@@ -37,6 +37,12 @@ func RegisterEncoder(format string, enc Encoder) {
 	encoders[format] = enc
 }
 
+// HasEncoder returns true if an Encoder is registered for the format.
+func HasEncoder(format string) bool {
+	_, ok := encoders[format]
+	return ok
+}
+
 func getEncoder(format string) (Encoder, error) {
 	enc, ok := encoders[format]
 	if !ok {
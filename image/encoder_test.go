@@ -33,6 +33,15 @@ func TestEncoderFunc(t *testing.T) {
 	}
 }
 
+func TestHasEncoder(t *testing.T) {
+	if !HasEncoder("jpeg") {
+		t.Fatal("jpeg encoder not registered")
+	}
+	if HasEncoder("unknown") {
+		t.Fatal("unknown encoder registered")
+	}
+}
+
 func TestDecode(t *testing.T) {
 	nim, err := Decode(testdata.Medium)
 	if err != nil {
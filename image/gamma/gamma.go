@@ -2,6 +2,7 @@
 package gamma
 
 import (
+	"context"
 	"image"
 	"image/draw"
 	"math"
@@ -99,14 +100,19 @@ func NewCorrectionProcessor(prc imageserver_image.Processor, enabled bool) *Corr
 
 // Process implements imageserver/image.Processor.
 func (prc *CorrectionProcessor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	return prc.ProcessContext(context.Background(), nim, params)
+}
+
+// ProcessContext implements imageserver/image.ContextProcessor.
+func (prc *CorrectionProcessor) ProcessContext(ctx context.Context, nim image.Image, params imageserver.Params) (image.Image, error) {
 	enabled, err := prc.isEnabled(params)
 	if err != nil {
 		return nil, err
 	}
 	if enabled {
-		return prc.process(nim, params)
+		return prc.process(ctx, nim, params)
 	}
-	return prc.Processor.Process(nim, params)
+	return imageserver_image.ProcessWithContext(ctx, prc.Processor, nim, params)
 }
 
 func (prc *CorrectionProcessor) isEnabled(params imageserver.Params) (bool, error) {
@@ -116,13 +122,16 @@ func (prc *CorrectionProcessor) isEnabled(params imageserver.Params) (bool, erro
 	return prc.enabled, nil
 }
 
-func (prc *CorrectionProcessor) process(nim image.Image, params imageserver.Params) (image.Image, error) {
+func (prc *CorrectionProcessor) process(ctx context.Context, nim image.Image, params imageserver.Params) (image.Image, error) {
 	original := nim
 	nim, _ = prc.before.Process(nim, params)
-	nim, err := prc.Processor.Process(nim, params)
+	nim, err := imageserver_image.ProcessWithContext(ctx, prc.Processor, nim, params)
 	if err != nil {
 		return nil, err
 	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	nim, _ = prc.after.Process(nim, params)
 	if isHighQuality(nim) && !isHighQuality(original) {
 		newNim := imageserver_image_internal.NewDrawableSize(original, nim.Bounds())
@@ -1,6 +1,7 @@
 package gamma
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"testing"
@@ -113,6 +114,24 @@ func TestCorrectionProcessor(t *testing.T) {
 	}
 }
 
+var _ imageserver_image.ContextProcessor = &CorrectionProcessor{}
+
+func TestCorrectionProcessorContext(t *testing.T) {
+	nim := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, enabled := range []bool{true, false} {
+		prc := NewCorrectionProcessor(imageserver_image.ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		}), enabled)
+		_, err := prc.ProcessContext(ctx, nim, imageserver.Params{})
+		if err != context.Canceled {
+			t.Fatalf("unexpected error for enabled=%t: %v", enabled, err)
+		}
+	}
+}
+
 func TestIsHighQuality(t *testing.T) {
 	r := image.Rect(0, 0, 1, 1)
 	type TC struct {
@@ -2,6 +2,7 @@ package gif
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image/gif"
 
@@ -22,20 +23,31 @@ type Handler struct {
 
 // Handle implements imageserver.Handler.
 func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *Handler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	if im.Format != "gif" {
 		return nil, &imageserver.ImageError{Message: fmt.Sprintf("image format is not gif: %s", im.Format)}
 	}
 	if !hdr.Processor.Change(params) {
 		return im, nil
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	g, err := gif.DecodeAll(bytes.NewReader(im.Data))
 	if err != nil {
 		return nil, &imageserver.ImageError{Message: err.Error()}
 	}
-	g, err = hdr.Processor.Process(g, params)
+	g, err = ProcessWithContext(ctx, hdr.Processor, g, params)
 	if err != nil {
 		return nil, err
 	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	buf := new(bytes.Buffer)
 	err = gif.EncodeAll(buf, g)
 	if err != nil {
@@ -59,11 +71,16 @@ type FallbackHandler struct {
 
 // Handle implements imageserver.Handler.
 func (hdr *FallbackHandler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *FallbackHandler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
 	h, err := hdr.getHandler(im, params)
 	if err != nil {
 		return nil, err
 	}
-	return h.Handle(im, params)
+	return imageserver.HandleWithContext(ctx, h, im, params)
 }
 
 func (hdr *FallbackHandler) getHandler(im *imageserver.Image, params imageserver.Params) (imageserver.Handler, error) {
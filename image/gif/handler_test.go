@@ -2,6 +2,7 @@ package gif
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image/gif"
 	"testing"
@@ -104,7 +105,48 @@ func TestHandlerErrorEncode(t *testing.T) {
 	}
 }
 
+var _ imageserver.ContextHandler = &Handler{}
+
+func TestHandlerContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hdr := &Handler{
+		Processor: ProcessorFunc(func(g *gif.GIF, params imageserver.Params) (*gif.GIF, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		}),
+	}
+	_, err := hdr.HandleContext(ctx, testdata.Animated, imageserver.Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 var _ imageserver.Handler = &FallbackHandler{}
+var _ imageserver.ContextHandler = &FallbackHandler{}
+
+func TestFallbackHandlerContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "foo")
+	called := false
+	hdr := &FallbackHandler{
+		Handler: &Handler{},
+		Fallback: imageserver.ContextHandlerFunc(func(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+			called = true
+			if ctx.Value(ctxKey{}) != "foo" {
+				t.Fatal("context not forwarded")
+			}
+			return im, nil
+		}),
+	}
+	_, err := hdr.HandleContext(ctx, testdata.Medium, imageserver.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("fallback not called")
+	}
+}
 
 func TestFallbackHandler(t *testing.T) {
 	type TC struct {
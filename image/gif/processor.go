@@ -1,6 +1,7 @@
 package gif
 
 import (
+	"context"
 	"image"
 	"image/gif"
 
@@ -15,6 +16,25 @@ type Processor interface {
 	imageserver_image.Changer
 }
 
+// ContextProcessor is a Processor that supports a context.Context.
+type ContextProcessor interface {
+	ProcessContext(context.Context, *gif.GIF, imageserver.Params) (*gif.GIF, error)
+}
+
+// ProcessWithContext calls the Processor with a context.Context.
+//
+// If the Processor implements ContextProcessor, ProcessContext() is called.
+// Otherwise, the context is checked before calling Process().
+func ProcessWithContext(ctx context.Context, prc Processor, g *gif.GIF, params imageserver.Params) (*gif.GIF, error) {
+	if cprc, ok := prc.(ContextProcessor); ok {
+		return cprc.ProcessContext(ctx, g, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return prc.Process(g, params)
+}
+
 // SimpleProcessor is a Processor implementation that processes each frames with the sub imageserver/image.Processor.
 type SimpleProcessor struct {
 	imageserver_image.Processor
@@ -22,9 +42,16 @@ type SimpleProcessor struct {
 
 // Process implements Processor.
 func (prc *SimpleProcessor) Process(g *gif.GIF, params imageserver.Params) (*gif.GIF, error) {
+	return prc.ProcessContext(context.Background(), g, params)
+}
+
+// ProcessContext implements ContextProcessor.
+//
+// The context is checked before each frame.
+func (prc *SimpleProcessor) ProcessContext(ctx context.Context, g *gif.GIF, params imageserver.Params) (*gif.GIF, error) {
 	out := new(gif.GIF)
 	var err error
-	out.Image, err = prc.processImages(g.Image, params)
+	out.Image, err = prc.processImages(ctx, g.Image, params)
 	if err != nil {
 		return nil, err
 	}
@@ -48,11 +75,11 @@ func (prc *SimpleProcessor) Process(g *gif.GIF, params imageserver.Params) (*gif
 	return out, nil
 }
 
-func (prc *SimpleProcessor) processImages(ps []*image.Paletted, params imageserver.Params) ([]*image.Paletted, error) {
+func (prc *SimpleProcessor) processImages(ctx context.Context, ps []*image.Paletted, params imageserver.Params) ([]*image.Paletted, error) {
 	out := make([]*image.Paletted, len(ps))
 	for i, p := range ps {
 		var err error
-		out[i], err = prc.processImage(p, params)
+		out[i], err = prc.processImage(ctx, p, params)
 		if err != nil {
 			return nil, err
 		}
@@ -60,8 +87,8 @@ func (prc *SimpleProcessor) processImages(ps []*image.Paletted, params imageserv
 	return out, nil
 }
 
-func (prc *SimpleProcessor) processImage(p *image.Paletted, params imageserver.Params) (*image.Paletted, error) {
-	tmp, err := prc.Processor.Process(p, params)
+func (prc *SimpleProcessor) processImage(ctx context.Context, p *image.Paletted, params imageserver.Params) (*image.Paletted, error) {
+	tmp, err := imageserver_image.ProcessWithContext(ctx, prc.Processor, p, params)
 	if err != nil {
 		return nil, err
 	}
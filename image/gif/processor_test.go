@@ -1,6 +1,7 @@
 package gif
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
@@ -61,6 +62,28 @@ func TestSimpleProcessorError(t *testing.T) {
 	}
 }
 
+var _ ContextProcessor = &SimpleProcessor{}
+
+func TestSimpleProcessorContext(t *testing.T) {
+	g := newTestImage()
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	prc := &SimpleProcessor{
+		Processor: imageserver_image.ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+			calls++
+			cancel()
+			return nim, nil
+		}),
+	}
+	_, err := prc.ProcessContext(ctx, g, imageserver.Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("unexpected calls: %d", calls)
+	}
+}
+
 var _ Processor = ProcessorFunc(nil)
 
 func TestProcessorFunc(t *testing.T) {
@@ -16,6 +16,12 @@ const (
 )
 
 // RotateProcessor is a imageserver/image.Processor implementation that rotates the Image with GIFT.
+//
+// All params are extracted from the "gift_rotate" node param and are optionals:
+//  - rotation: angle in degrees (counter-clockwise)
+//  - background: hex color, for the areas outside of the rotated Image
+//  - interpolation: nearest_neighbor, linear or cubic (default: DefaultInterpolation)
+//  - flip: horizontal or vertical, applied before the rotation
 type RotateProcessor struct {
 	DefaultInterpolation gift.Interpolation
 }
@@ -47,14 +53,25 @@ func (prc *RotateProcessor) process(nim image.Image, params imageserver.Params)
 	if err != nil {
 		return nil, err
 	}
-	if rot == 0 {
-		return nim, nil
-	}
-	f, err := prc.getFilter(rot, params)
+	var fs []gift.Filter
+	flip, err := prc.getFlipFilter(params)
 	if err != nil {
 		return nil, err
 	}
-	g := gift.New(f)
+	if flip != nil {
+		fs = append(fs, flip)
+	}
+	if rot != 0 {
+		f, err := prc.getFilter(rot, params)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 0 {
+		return nim, nil
+	}
+	g := gift.New(fs...)
 	out := imageserver_image_internal.NewDrawableSize(nim, g.Bounds(nim.Bounds()))
 	g.Draw(out, nim)
 	return out, nil
@@ -77,6 +94,23 @@ func (prc *RotateProcessor) getRotation(params imageserver.Params) (float32, err
 	return float32(rot), nil
 }
 
+func (prc *RotateProcessor) getFlipFilter(params imageserver.Params) (gift.Filter, error) {
+	if !params.Has("flip") {
+		return nil, nil
+	}
+	flip, err := params.GetString("flip")
+	if err != nil {
+		return nil, err
+	}
+	switch flip {
+	case "horizontal":
+		return gift.FlipHorizontal(), nil
+	case "vertical":
+		return gift.FlipVertical(), nil
+	}
+	return nil, &imageserver.ParamError{Param: "flip", Message: "invalid value"}
+}
+
 func (prc *RotateProcessor) getFilter(rot float32, params imageserver.Params) (gift.Filter, error) {
 	switch rot {
 	case 90:
@@ -143,7 +177,7 @@ func (prc *RotateProcessor) Change(params imageserver.Params) bool {
 	if params.Empty() {
 		return false
 	}
-	if params.Has("rotation") {
+	if params.Has("rotation") || params.Has("flip") {
 		return true
 	}
 	return false
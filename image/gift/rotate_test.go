@@ -105,6 +105,22 @@ func TestRotateProcessorProcess(t *testing.T) {
 				"interpolation": "cubic",
 			}},
 		},
+		// flip
+		{
+			params: imageserver.Params{rotateParam: imageserver.Params{
+				"flip": "horizontal",
+			}},
+			expectedWidth:  1024,
+			expectedHeight: 819,
+		},
+		{
+			params: imageserver.Params{rotateParam: imageserver.Params{
+				"rotation": 90.0,
+				"flip":     "vertical",
+			}},
+			expectedWidth:  819,
+			expectedHeight: 1024,
+		},
 		// error
 		{
 			params:             imageserver.Params{rotateParam: "invalid"},
@@ -144,6 +160,18 @@ func TestRotateProcessorProcess(t *testing.T) {
 			}},
 			expectedParamError: rotateParam + ".interpolation",
 		},
+		{
+			params: imageserver.Params{rotateParam: imageserver.Params{
+				"flip": "invalid",
+			}},
+			expectedParamError: rotateParam + ".flip",
+		},
+		{
+			params: imageserver.Params{rotateParam: imageserver.Params{
+				"flip": 666,
+			}},
+			expectedParamError: rotateParam + ".flip",
+		},
 	} {
 		func() {
 			defer func() {
@@ -259,6 +287,12 @@ func TestRotateProcessorChange(t *testing.T) {
 			}},
 			expected: true,
 		},
+		{
+			params: imageserver.Params{rotateParam: imageserver.Params{
+				"flip": "horizontal",
+			}},
+			expected: true,
+		},
 		{
 			params: imageserver.Params{rotateParam: imageserver.Params{
 				"foo": "bar",
@@ -1,6 +1,9 @@
 package image
 
 import (
+	"context"
+	"image"
+
 	"github.com/pierrre/imageserver"
 )
 
@@ -16,6 +19,20 @@ type Handler struct {
 
 // Handle implements imageserver.Handler.
 func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return hdr.HandleContext(context.Background(), im, params)
+}
+
+// HandleContext implements imageserver.ContextHandler.
+func (hdr *Handler) HandleContext(ctx context.Context, im *imageserver.Image, params imageserver.Params) (*imageserver.Image, error) {
+	return handle(ctx, hdr.Processor, im, params, func() (image.Image, error) {
+		return Decode(im)
+	})
+}
+
+// handle processes the Image with the Processor (optional), and encodes it with the "format" param.
+//
+// decode is called only if there is something to do.
+func handle(ctx context.Context, prc Processor, im *imageserver.Image, params imageserver.Params, decode func() (image.Image, error)) (*imageserver.Image, error) {
 	enc, format, err := getEncoderFormat(im.Format, params)
 	if err != nil {
 		if _, ok := err.(*imageserver.ParamError); !ok {
@@ -23,19 +40,22 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 		}
 		return nil, err
 	}
-	if !hdr.change(im, format, enc, params) {
+	if !change(prc, im, format, enc, params) {
 		return im, nil
 	}
-	nim, err := Decode(im)
+	nim, err := decode()
 	if err != nil {
 		return nil, err
 	}
-	if hdr.Processor != nil {
-		nim, err = hdr.Processor.Process(nim, params)
+	if prc != nil {
+		nim, err = ProcessWithContext(ctx, prc, nim, params)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
 	im, err = encode(nim, format, enc, params)
 	if err != nil {
 		return nil, err
@@ -43,11 +63,11 @@ func (hdr *Handler) Handle(im *imageserver.Image, params imageserver.Params) (*i
 	return im, nil
 }
 
-func (hdr *Handler) change(im *imageserver.Image, format string, enc Encoder, params imageserver.Params) bool {
+func change(prc Processor, im *imageserver.Image, format string, enc Encoder, params imageserver.Params) bool {
 	if format != im.Format {
 		return true
 	}
-	if hdr.Processor != nil && hdr.Processor.Change(params) {
+	if prc != nil && prc.Change(params) {
 		return true
 	}
 	if enc.Change(params) {
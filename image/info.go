@@ -0,0 +1,110 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+
+	"github.com/pierrre/imageserver"
+)
+
+// InfoFormat is the format of the Image returned by InfoServer.
+const InfoFormat = "json"
+
+// Info contains information about an Image.
+type Info struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int    `json:"size"`   // Size in bytes.
+	Frames int    `json:"frames"` // Number of frames (greater than 1 for animated GIFs).
+	Alpha  bool   `json:"alpha"`  // True if the color model supports transparency.
+}
+
+// GetInfo returns the Info of an Image.
+//
+// The dimensions are read with image.DecodeConfig(), so only the header is decoded (the decoder must be registered).
+// GIF images are fully decoded with gif.DecodeAll() to count the frames.
+func GetInfo(im *imageserver.Image) (*Info, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(im.Data))
+	if err != nil {
+		return nil, &imageserver.ImageError{Message: fmt.Sprintf("decode config: %s", err)}
+	}
+	info := &Info{
+		Format: format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Size:   len(im.Data),
+		Frames: 1,
+		Alpha:  hasAlpha(cfg.ColorModel),
+	}
+	if format == "gif" {
+		g, err := gif.DecodeAll(bytes.NewReader(im.Data))
+		if err != nil {
+			return nil, &imageserver.ImageError{Message: fmt.Sprintf("decode gif: %s", err)}
+		}
+		info.Frames = len(g.Image)
+		for _, frame := range g.Image {
+			if hasAlpha(frame.Palette) {
+				info.Alpha = true
+				break
+			}
+		}
+	}
+	return info, nil
+}
+
+func hasAlpha(m color.Model) bool {
+	switch m := m.(type) {
+	case color.Palette:
+		for _, c := range m {
+			if _, _, _, a := c.RGBA(); a != 0xffff {
+				return true
+			}
+		}
+		return false
+	}
+	switch m {
+	case color.GrayModel, color.Gray16Model, color.YCbCrModel, color.CMYKModel:
+		return false
+	}
+	return true
+}
+
+// InfoServer is a imageserver.Server implementation that returns the Info of the Image returned by the underlying Server.
+//
+// The returned Image contains the Info encoded as JSON, and has the "json" format (see InfoFormat).
+// It can be cached like any other Image (e.g. with imageserver/cache.Server),
+// but the cache keys must be different from the keys of the Images (e.g. with a prefix).
+type InfoServer struct {
+	imageserver.Server
+}
+
+// Get implements imageserver.Server.
+func (srv *InfoServer) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (srv *InfoServer) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	im, err := imageserver.GetWithContext(ctx, srv.Server, params)
+	if err != nil {
+		return nil, err
+	}
+	info, err := GetInfo(im)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return &imageserver.Image{
+		Format: InfoFormat,
+		Data:   data,
+	}, nil
+}
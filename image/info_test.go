@@ -0,0 +1,80 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	_ "image/jpeg"
+	_ "image/png"
+	"testing"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestGetInfo(t *testing.T) {
+	for _, tc := range []struct {
+		im       *imageserver.Image
+		expected Info
+	}{
+		{testdata.Medium, Info{Format: "jpeg", Width: 1024, Height: 819, Size: len(testdata.Medium.Data), Frames: 1}},
+		{testdata.Rings, Info{Format: "png", Width: 1000, Height: 1000, Size: len(testdata.Rings.Data), Frames: 1}},
+		{testdata.Random, Info{Format: "png", Width: 1024, Height: 1024, Size: len(testdata.Random.Data), Frames: 1, Alpha: true}},
+		{testdata.Animated, Info{Format: "gif", Width: 600, Height: 338, Size: len(testdata.Animated.Data), Frames: 36, Alpha: true}},
+		{testdata.Spaceship, Info{Format: "gif", Width: 384, Height: 384, Size: len(testdata.Spaceship.Data), Frames: 60}},
+	} {
+		info, err := GetInfo(tc.im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *info != tc.expected {
+			t.Fatalf("unexpected info: got %+v, want %+v", info, tc.expected)
+		}
+	}
+}
+
+func TestGetInfoErrorInvalid(t *testing.T) {
+	_, err := GetInfo(testdata.Invalid)
+	if _, ok := err.(*imageserver.ImageError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+var _ imageserver.ContextServer = &InfoServer{}
+
+func TestInfoServer(t *testing.T) {
+	srv := &InfoServer{Server: testdata.Server}
+	im, err := srv.Get(imageserver.Params{imageserver.SourceParam: testdata.MediumFileName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Format != InfoFormat {
+		t.Fatalf("unexpected format: %s", im.Format)
+	}
+	info := new(Info)
+	err = json.Unmarshal(im.Data, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 1024 || info.Height != 819 {
+		t.Fatalf("unexpected size: %dx%d", info.Width, info.Height)
+	}
+}
+
+func TestInfoServerError(t *testing.T) {
+	srv := &InfoServer{Server: testdata.Server}
+	for _, params := range []imageserver.Params{
+		{imageserver.SourceParam: "unknown"},
+		{imageserver.SourceParam: testdata.InvalidFileName},
+	} {
+		_, err := srv.Get(params)
+		if err == nil {
+			t.Fatalf("no error for %v", params)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := srv.GetContext(ctx, imageserver.Params{imageserver.SourceParam: testdata.MediumFileName})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package image
 
 import (
+	"context"
 	"image"
 
 	"github.com/pierrre/imageserver"
@@ -27,14 +28,60 @@ func (f ProcessorFunc) Change(params imageserver.Params) bool {
 	return true
 }
 
+// ContextProcessor is a Processor that supports a context.Context.
+type ContextProcessor interface {
+	ProcessContext(context.Context, image.Image, imageserver.Params) (image.Image, error)
+}
+
+// ContextProcessorFunc is a ContextProcessor func.
+//
+// It also implements Processor, with context.Background().
+type ContextProcessorFunc func(context.Context, image.Image, imageserver.Params) (image.Image, error)
+
+// ProcessContext implements ContextProcessor.
+func (f ContextProcessorFunc) ProcessContext(ctx context.Context, nim image.Image, params imageserver.Params) (image.Image, error) {
+	return f(ctx, nim, params)
+}
+
+// Process implements Processor.
+func (f ContextProcessorFunc) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	return f(context.Background(), nim, params)
+}
+
+// Change implements Processor.
+func (f ContextProcessorFunc) Change(params imageserver.Params) bool {
+	return true
+}
+
+// ProcessWithContext calls the Processor with a context.Context.
+//
+// If the Processor implements ContextProcessor, ProcessContext() is called.
+// Otherwise, the context is checked before calling Process().
+func ProcessWithContext(ctx context.Context, prc Processor, nim image.Image, params imageserver.Params) (image.Image, error) {
+	if cprc, ok := prc.(ContextProcessor); ok {
+		return cprc.ProcessContext(ctx, nim, params)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return prc.Process(nim, params)
+}
+
 // ListProcessor is a Processor implementation that wrap a list of Processor.
+//
+// The context is checked between each Processor.
 type ListProcessor []Processor
 
 // Process implements Processor.
 func (prc ListProcessor) Process(nim image.Image, params imageserver.Params) (image.Image, error) {
+	return prc.ProcessContext(context.Background(), nim, params)
+}
+
+// ProcessContext implements ContextProcessor.
+func (prc ListProcessor) ProcessContext(ctx context.Context, nim image.Image, params imageserver.Params) (image.Image, error) {
 	for _, p := range prc {
 		var err error
-		nim, err = p.Process(nim, params)
+		nim, err = ProcessWithContext(ctx, p, nim, params)
 		if err != nil {
 			return nil, err
 		}
@@ -61,3 +108,8 @@ type ChangeProcessor struct {
 func (prc *ChangeProcessor) Change(params imageserver.Params) bool {
 	return true
 }
+
+// ProcessContext implements ContextProcessor.
+func (prc *ChangeProcessor) ProcessContext(ctx context.Context, nim image.Image, params imageserver.Params) (image.Image, error) {
+	return ProcessWithContext(ctx, prc.Processor, nim, params)
+}
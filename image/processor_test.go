@@ -1,6 +1,7 @@
 package image
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"testing"
@@ -108,3 +109,43 @@ func TestChangeProcessor(t *testing.T) {
 		t.Fatal("not true")
 	}
 }
+
+var _ ContextProcessor = &ChangeProcessor{}
+
+func TestChangeProcessorProcessContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	prc := &ChangeProcessor{
+		Processor: ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		}),
+	}
+	nim := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	_, err := prc.ProcessContext(ctx, nim, imageserver.Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+var _ ContextProcessor = ListProcessor{}
+var _ Processor = ContextProcessorFunc(nil)
+
+func TestListProcessorProcessContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	prc := ListProcessor{
+		ContextProcessorFunc(func(ctx context.Context, nim image.Image, params imageserver.Params) (image.Image, error) {
+			cancel()
+			return nim, nil
+		}),
+		ProcessorFunc(func(nim image.Image, params imageserver.Params) (image.Image, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		}),
+	}
+	nim := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	_, err := prc.ProcessContext(ctx, nim, imageserver.Params{})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding"
 	"encoding/binary"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"unsafe"
@@ -173,3 +174,72 @@ func imageCopy(im *Image) *Image {
 	value := *im
 	return &value
 }
+
+func TestImageMarshalMetadata(t *testing.T) {
+	im1 := &Image{
+		Format: testdata.Small.Format,
+		Data:   testdata.Small.Data,
+		Metadata: map[string]string{
+			"foo": "bar",
+			"baz": "",
+		},
+	}
+	data, err := im1.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im2 := new(Image)
+	err = im2.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ImageEqual(im1, im2) {
+		t.Fatal("image not equals")
+	}
+	if !reflect.DeepEqual(im1.Metadata, im2.Metadata) {
+		t.Fatalf("unexpected metadata: got %v, want %v", im2.Metadata, im1.Metadata)
+	}
+	// Truncated metadata.
+	for i := len(data) - 1; i > len(data)-20; i-- {
+		err = new(Image).UnmarshalBinary(data[:i])
+		if _, ok := err.(*ImageError); !ok {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestImageMarshalMetadataErrorMaxLen(t *testing.T) {
+	im := &Image{Metadata: map[string]string{"foo": strings.Repeat("a", ImageMetadataValueMaxLen+1)}}
+	_, err := im.MarshalBinary()
+	if _, ok := err.(*ImageError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	im = &Image{Metadata: make(map[string]string)}
+	for i := 0; i <= ImageMetadataMaxLen; i++ {
+		im.Metadata[strconv.Itoa(i)] = ""
+	}
+	_, err = im.MarshalBinary()
+	if _, ok := err.(*ImageError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestImageUnmarshalBinaryErrorMetadataMaxLen(t *testing.T) {
+	im := &Image{Metadata: map[string]string{"foo": "bar"}}
+	data, err := im.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataLenPosition := 4 + 4
+	binary.LittleEndian.PutUint32(data[metadataLenPosition:metadataLenPosition+4], uint32(ImageMetadataMaxLen+1))
+	err = new(Image).UnmarshalBinary(data)
+	if _, ok := err.(*ImageError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	binary.LittleEndian.PutUint32(data[metadataLenPosition:metadataLenPosition+4], 1)
+	binary.LittleEndian.PutUint32(data[metadataLenPosition+4:metadataLenPosition+8], uint32(ImageMetadataValueMaxLen+1))
+	err = new(Image).UnmarshalBinary(data)
+	if _, ok := err.(*ImageError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
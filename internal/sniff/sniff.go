@@ -0,0 +1,47 @@
+// Package sniff provides image format detection from magic bytes.
+package sniff
+
+import (
+	"bytes"
+)
+
+// MinLen is the number of bytes required to detect all supported formats.
+const MinLen = 12
+
+type signature struct {
+	format string
+	match  func(data []byte) bool
+}
+
+var signatures = []signature{
+	{"jpeg", prefix("\xff\xd8\xff")},
+	{"png", prefix("\x89PNG\r\n\x1a\n")},
+	{"gif", func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+	}},
+	{"bmp", prefix("BM")},
+	{"tiff", func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+	}},
+	{"webp", func(data []byte) bool {
+		return len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP"))
+	}},
+}
+
+func prefix(p string) func(data []byte) bool {
+	return func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte(p))
+	}
+}
+
+// Format returns the image format detected from the first bytes of data (e.g. "jpeg", "png", "gif").
+//
+// It returns an empty string if the format is unknown.
+func Format(data []byte) string {
+	for _, sig := range signatures {
+		if sig.match(data) {
+			return sig.format
+		}
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package sniff
+
+import (
+	"testing"
+
+	"github.com/pierrre/imageserver/testdata"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		data     []byte
+		expected string
+	}{
+		{testdata.Medium.Data, "jpeg"},
+		{testdata.Animated.Data, "gif"},
+		{testdata.Random.Data, "png"},
+		{[]byte("BM\x00\x00"), "bmp"},
+		{[]byte("II*\x00\x08\x00"), "tiff"},
+		{[]byte("MM\x00*\x00\x08"), "tiff"},
+		{[]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "webp"},
+		{[]byte("RIFF\x00\x00\x00\x00WAVE"), ""},
+		{[]byte("foobar"), ""},
+		{nil, ""},
+	} {
+		got := Format(tc.data)
+		if got != tc.expected {
+			t.Fatalf("unexpected format: got \"%s\", want \"%s\"", got, tc.expected)
+		}
+	}
+}
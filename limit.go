@@ -0,0 +1,254 @@
+package imageserver
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PriorityLimitServer is a Server implementation that limits the number of concurrent executions, with priorities and load shedding.
+//
+// When all slots are busy, calls wait in a bounded queue.
+// The call with the highest priority gets the next free slot (calls with the same priority are served in order).
+// If the queue is full, the call with the lowest priority is rejected (either the new call, or a queued call with a lower priority).
+//
+// Rejected calls return a *LimitError.
+//
+// Create it with NewPriorityLimitServer, then set the optional fields before using it.
+type PriorityLimitServer struct {
+	Server
+
+	// MaxQueue is the maximum number of waiting calls.
+	// 0 means that calls are rejected immediately if all slots are busy.
+	// A negative value means no limit.
+	MaxQueue int
+
+	// MaxWait is an optional maximum wait duration in the queue.
+	MaxWait time.Duration
+
+	// PriorityFunc is an optional function that returns the priority of a call (higher is served first).
+	// The default priority is 0.
+	PriorityFunc func(Params) int
+
+	// RetryAfter is an optional duration returned in the LimitError.
+	RetryAfter time.Duration
+
+	limit    int
+	mu       sync.Mutex
+	running  int
+	queue    limitQueue
+	seq      uint64
+	rejected uint64
+	timedOut uint64
+}
+
+// NewPriorityLimitServer creates a new PriorityLimitServer.
+//
+// limit is the maximum number of concurrent executions.
+func NewPriorityLimitServer(s Server, limit int) *PriorityLimitServer {
+	return &PriorityLimitServer{
+		Server:   s,
+		MaxQueue: -1,
+		limit:    limit,
+	}
+}
+
+// Get implements Server.
+func (s *PriorityLimitServer) Get(params Params) (*Image, error) {
+	return s.GetContext(context.Background(), params)
+}
+
+// GetContext implements ContextServer.
+func (s *PriorityLimitServer) GetContext(ctx context.Context, params Params) (*Image, error) {
+	err := s.acquire(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+	return GetWithContext(ctx, s.Server, params)
+}
+
+func (s *PriorityLimitServer) acquire(ctx context.Context, params Params) error {
+	priority := 0
+	if s.PriorityFunc != nil {
+		priority = s.PriorityFunc(params)
+	}
+	s.mu.Lock()
+	if s.running < s.limit && s.queue.Len() == 0 {
+		s.running++
+		s.mu.Unlock()
+		return nil
+	}
+	if s.MaxQueue >= 0 && s.queue.Len() >= s.MaxQueue {
+		lowest := s.queue.lowest()
+		if lowest == nil || lowest.priority >= priority {
+			s.rejected++
+			s.mu.Unlock()
+			return s.newError("queue is full")
+		}
+		heap.Remove(&s.queue, lowest.index)
+		s.rejected++
+		lowest.result <- s.newError("queue is full")
+	}
+	w := &limitWaiter{
+		priority: priority,
+		seq:      s.seq,
+		result:   make(chan error, 1),
+	}
+	s.seq++
+	heap.Push(&s.queue, w)
+	s.mu.Unlock()
+
+	var timeoutCh <-chan time.Time
+	if s.MaxWait != 0 {
+		timer := time.NewTimer(s.MaxWait)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	select {
+	case err := <-w.result:
+		return err
+	case <-timeoutCh:
+		return s.cancelWait(w, s.newError(fmt.Sprintf("wait timeout after %s", s.MaxWait)))
+	case <-ctx.Done():
+		return s.cancelWait(w, ctx.Err())
+	}
+}
+
+// cancelWait removes the waiter from the queue.
+// If the waiter got a result in the meantime, it is returned instead of err.
+func (s *PriorityLimitServer) cancelWait(w *limitWaiter, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.index < 0 {
+		// The waiter is not in the queue anymore.
+		res := <-w.result
+		if res != nil {
+			return res
+		}
+		// It got a slot.
+		if _, ok := err.(*LimitError); !ok {
+			s.releaseLocked()
+			return err
+		}
+		return nil
+	}
+	heap.Remove(&s.queue, w.index)
+	if _, ok := err.(*LimitError); ok {
+		s.timedOut++
+	}
+	return err
+}
+
+func (s *PriorityLimitServer) release() {
+	s.mu.Lock()
+	s.releaseLocked()
+	s.mu.Unlock()
+}
+
+func (s *PriorityLimitServer) releaseLocked() {
+	if s.queue.Len() > 0 {
+		// The slot is given to the next waiter.
+		w := heap.Pop(&s.queue).(*limitWaiter)
+		w.result <- nil
+		return
+	}
+	s.running--
+}
+
+func (s *PriorityLimitServer) newError(msg string) *LimitError {
+	return &LimitError{
+		Message:    msg,
+		RetryAfter: s.RetryAfter,
+	}
+}
+
+// Stats returns the current stats.
+//
+// It can be used for monitoring.
+func (s *PriorityLimitServer) Stats() LimitStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return LimitStats{
+		Running:  s.running,
+		Queued:   s.queue.Len(),
+		Rejected: s.rejected,
+		TimedOut: s.timedOut,
+	}
+}
+
+// LimitStats contains the stats of a PriorityLimitServer.
+type LimitStats struct {
+	Running  int    // Number of running calls
+	Queued   int    // Number of waiting calls
+	Rejected uint64 // Total number of calls rejected because the queue was full
+	TimedOut uint64 // Total number of calls rejected because they waited for too long
+}
+
+// LimitError is returned when a call is rejected by a limit.
+type LimitError struct {
+	Message string
+
+	// RetryAfter is an optional duration after which the call can be retried.
+	RetryAfter time.Duration
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("limit error: %s", err.Message)
+}
+
+type limitWaiter struct {
+	priority int
+	seq      uint64
+	index    int
+	result   chan error
+}
+
+// limitQueue is a heap of limitWaiter, with the highest priority first.
+type limitQueue []*limitWaiter
+
+func (q limitQueue) Len() int {
+	return len(q)
+}
+
+func (q limitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q limitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *limitQueue) Push(x interface{}) {
+	w := x.(*limitWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *limitQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
+
+// lowest returns the waiter with the lowest priority, that arrived last.
+func (q limitQueue) lowest() *limitWaiter {
+	var res *limitWaiter
+	for _, w := range q {
+		if res == nil || w.priority < res.priority || (w.priority == res.priority && w.seq > res.seq) {
+			res = w
+		}
+	}
+	return res
+}
@@ -0,0 +1,163 @@
+package imageserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ ContextServer = &PriorityLimitServer{}
+
+func TestPriorityLimitServer(t *testing.T) {
+	srv := NewPriorityLimitServer(ServerFunc(func(params Params) (*Image, error) {
+		return &Image{}, nil
+	}), 1)
+	_, err := srv.Get(Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := srv.Stats()
+	if stats.Running != 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats: %#v", stats)
+	}
+}
+
+func TestPriorityLimitServerOrder(t *testing.T) {
+	block := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	srv := NewPriorityLimitServer(ServerFunc(func(params Params) (*Image, error) {
+		name, _ := params.GetString("name")
+		if name == "first" {
+			<-block
+		}
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+		return &Image{}, nil
+	}), 1)
+	srv.PriorityFunc = func(params Params) int {
+		p, _ := params.GetInt("priority")
+		return p
+	}
+	var wg sync.WaitGroup
+	get := func(name string, priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := srv.Get(Params{"name": name, "priority": priority})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	get("first", 0)
+	waitLimitStats(t, srv, 1, 0)
+	get("low", 0)
+	waitLimitStats(t, srv, 1, 1)
+	get("high", 10)
+	waitLimitStats(t, srv, 1, 2)
+	close(block)
+	wg.Wait()
+	want := []string{"first", "high", "low"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("unexpected order: got %v, want %v", order, want)
+	}
+}
+
+func TestPriorityLimitServerQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	srv := NewPriorityLimitServer(ServerFunc(func(params Params) (*Image, error) {
+		<-block
+		return &Image{}, nil
+	}), 1)
+	srv.MaxQueue = 1
+	srv.RetryAfter = 1 * time.Second
+	srv.PriorityFunc = func(params Params) int {
+		p, _ := params.GetInt("priority")
+		return p
+	}
+	defer close(block)
+	go srv.Get(Params{})
+	waitLimitStats(t, srv, 1, 0)
+	lowErr := make(chan error, 1)
+	go func() {
+		_, err := srv.Get(Params{})
+		lowErr <- err
+	}()
+	waitLimitStats(t, srv, 1, 1)
+
+	// Same priority: the new call is rejected.
+	_, err := srv.Get(Params{})
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limitErr.RetryAfter != srv.RetryAfter {
+		t.Fatalf("unexpected retry after: got %s, want %s", limitErr.RetryAfter, srv.RetryAfter)
+	}
+
+	// Higher priority: the queued call is rejected.
+	go srv.Get(Params{"priority": 1})
+	err = <-lowErr
+	if _, ok := err.(*LimitError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitLimitStats(t, srv, 1, 1)
+	if stats := srv.Stats(); stats.Rejected != 2 {
+		t.Fatalf("unexpected rejected count: got %d, want %d", stats.Rejected, 2)
+	}
+}
+
+func TestPriorityLimitServerMaxWait(t *testing.T) {
+	block := make(chan struct{})
+	srv := NewPriorityLimitServer(ServerFunc(func(params Params) (*Image, error) {
+		<-block
+		return &Image{}, nil
+	}), 1)
+	srv.MaxWait = 10 * time.Millisecond
+	defer close(block)
+	go srv.Get(Params{})
+	waitLimitStats(t, srv, 1, 0)
+	_, err := srv.Get(Params{})
+	if _, ok := err.(*LimitError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stats := srv.Stats()
+	if stats.TimedOut != 1 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats: %#v", stats)
+	}
+}
+
+func TestPriorityLimitServerContextCanceled(t *testing.T) {
+	block := make(chan struct{})
+	srv := NewPriorityLimitServer(ServerFunc(func(params Params) (*Image, error) {
+		<-block
+		return &Image{}, nil
+	}), 1)
+	defer close(block)
+	go srv.Get(Params{})
+	waitLimitStats(t, srv, 1, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := srv.GetContext(ctx, Params{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := srv.Stats(); stats.Queued != 0 {
+		t.Fatalf("unexpected stats: %#v", stats)
+	}
+}
+
+func waitLimitStats(t *testing.T, srv *PriorityLimitServer, running, queued int) {
+	for i := 0; i < 1000; i++ {
+		stats := srv.Stats()
+		if stats.Running == running && stats.Queued == queued {
+			return
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	t.Fatalf("timeout while waiting for stats: %#v", srv.Stats())
+}
@@ -168,8 +168,19 @@ func (params Params) toBuffer(buf *bytes.Buffer) {
 type ParamError struct {
 	Param   string // Nested param path uses "." as separator
 	Message string
+
+	// NotFound is true if the param refers to something that doesn't exist (e.g. the source Image).
+	// It allows to distinguish a missing Image from an unavailable origin (see FailoverNotFound).
+	NotFound bool
 }
 
 func (err *ParamError) Error() string {
 	return fmt.Sprintf("invalid param \"%s\": %s", err.Param, err.Message)
 }
+
+// NewSourceNotFoundError returns a *ParamError for the "source" param, with NotFound set.
+//
+// Sources return it when the Image doesn't exist.
+func NewSourceNotFoundError(message string) *ParamError {
+	return &ParamError{Param: SourceParam, Message: message, NotFound: true}
+}
@@ -0,0 +1,190 @@
+// Package s3source provides a imageserver.Server implementation that gets the Image from an S3-compatible object storage.
+package s3source
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pierrre/imageserver"
+	"github.com/pierrre/imageserver/internal/sniff"
+)
+
+var contentTypeRegexp = regexp.MustCompile("^image/(.+)$")
+
+// Server is a imageserver.Server implementation that gets the Image from an S3-compatible object storage.
+//
+// The "source" param is the object key (a leading "/" is removed).
+// If Bucket is empty, the first path segment of the "source" param is the bucket.
+//
+// Requests are path-style ("{Endpoint}/{bucket}/{key}") and signed with AWS Signature Version 4.
+// Path-style requests work with AWS S3 and with the S3-compatible servers (e.g. MinIO).
+//
+// It returns a *imageserver.ParamError with NotFound set if the object or the bucket doesn't exist ("NoSuchKey", "NoSuchBucket").
+// Other storage errors are returned as *Error.
+//
+// The Image type is determined by the "Content-Type" header, or detected from the content (magic bytes).
+type Server struct {
+	// Endpoint is the URL of the storage, e.g. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+
+	// Region is the region used for the signature, e.g. "us-east-1".
+	Region string
+
+	// Bucket is an optional bucket name.
+	Bucket string
+
+	// Credentials are the credentials used to sign the requests.
+	Credentials Credentials
+
+	// Client is an optional HTTP client.
+	// http.DefaultClient is used by default.
+	Client *http.Client
+
+	// MaxSize is an optional maximum object size (in bytes).
+	MaxSize int64
+}
+
+// Get implements imageserver.Server.
+func (srv *Server) Get(params imageserver.Params) (*imageserver.Image, error) {
+	return srv.GetContext(context.Background(), params)
+}
+
+// GetContext implements imageserver.ContextServer.
+func (srv *Server) GetContext(ctx context.Context, params imageserver.Params) (*imageserver.Image, error) {
+	bucket, key, err := srv.getBucketKey(params)
+	if err != nil {
+		return nil, err
+	}
+	req, err := srv.newRequest(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	c := srv.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	response, err := c.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	defer response.Body.Close()
+	im, err := srv.parseResponse(response)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return im, nil
+}
+
+func (srv *Server) getBucketKey(params imageserver.Params) (bucket string, key string, err error) {
+	source, err := params.GetString(imageserver.SourceParam)
+	if err != nil {
+		return "", "", err
+	}
+	key = strings.TrimPrefix(source, "/")
+	bucket = srv.Bucket
+	if bucket == "" {
+		i := strings.Index(key, "/")
+		if i <= 0 {
+			return "", "", &imageserver.ParamError{Param: imageserver.SourceParam, Message: "must contain the bucket and the key"}
+		}
+		bucket, key = key[:i], key[i+1:]
+	}
+	if key == "" {
+		return "", "", &imageserver.ParamError{Param: imageserver.SourceParam, Message: "empty key"}
+	}
+	return bucket, key, nil
+}
+
+func (srv *Server) newRequest(bucket string, key string) (*http.Request, error) {
+	u, err := url.Parse(srv.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + key
+	u.RawPath = escapePath(u.Path)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signRequest(req, &srv.Credentials, srv.Region, time.Now())
+	return req, nil
+}
+
+func (srv *Server) parseResponse(response *http.Response) (*imageserver.Image, error) {
+	if response.StatusCode != http.StatusOK {
+		return nil, parseErrorResponse(response)
+	}
+	if srv.MaxSize > 0 && response.ContentLength > srv.MaxSize {
+		return nil, srv.newSizeError()
+	}
+	var r io.Reader = response.Body
+	if srv.MaxSize > 0 {
+		r = io.LimitReader(r, srv.MaxSize+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if srv.MaxSize > 0 && int64(len(data)) > srv.MaxSize {
+		return nil, srv.newSizeError()
+	}
+	im := &imageserver.Image{
+		Data: data,
+	}
+	matches := contentTypeRegexp.FindStringSubmatch(response.Header.Get("Content-Type"))
+	if len(matches) == 2 {
+		im.Format = matches[1]
+	} else {
+		im.Format = sniff.Format(data)
+	}
+	return im, nil
+}
+
+func (srv *Server) newSizeError() error {
+	return &imageserver.ParamError{
+		Param:   imageserver.SourceParam,
+		Message: fmt.Sprintf("object size is greater than the maximum value %d", srv.MaxSize),
+	}
+}
+
+func parseErrorResponse(response *http.Response) error {
+	err := &Error{
+		StatusCode: response.StatusCode,
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1<<16))
+	xml.Unmarshal(data, err)
+	switch {
+	case err.Code == "NoSuchKey" || err.Code == "NoSuchBucket":
+		return imageserver.NewSourceNotFoundError("not found")
+	case err.Code == "" && response.StatusCode == http.StatusNotFound:
+		// HEAD-like responses have no body.
+		return imageserver.NewSourceNotFoundError("not found")
+	}
+	return err
+}
+
+// Error is an error returned by the object storage.
+type Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("s3 error %d: %s: %s", err.StatusCode, err.Code, err.Message)
+}
@@ -1,6 +1,10 @@
 // Package imageserver provides an Image server toolkit.
 package imageserver
 
+import (
+	"context"
+)
+
 // Server serves an Image.
 type Server interface {
 	Get(Params) (*Image, error)
@@ -26,17 +30,23 @@ type SourceServer struct {
 
 // Get implements Server.
 func (s *SourceServer) Get(params Params) (*Image, error) {
+	return s.GetContext(context.Background(), params)
+}
+
+// GetContext implements ContextServer.
+func (s *SourceServer) GetContext(ctx context.Context, params Params) (*Image, error) {
 	source, err := params.Get(SourceParam)
 	if err != nil {
 		return nil, err
 	}
 	params = Params{SourceParam: source}
-	return s.Server.Get(params)
+	return GetWithContext(ctx, s.Server, params)
 }
 
 // NewLimitServer creates a new Server that limits the number of concurrent executions.
 //
 // It uses a buffered channel to limit the number of concurrent executions.
+// If the Server is called with a context.Context, it stops waiting when the context is done.
 func NewLimitServer(s Server, limit int) Server {
 	return &limitServer{
 		Server:  s,
@@ -50,9 +60,17 @@ type limitServer struct {
 }
 
 func (s *limitServer) Get(params Params) (*Image, error) {
-	s.limitCh <- struct{}{}
+	return s.GetContext(context.Background(), params)
+}
+
+func (s *limitServer) GetContext(ctx context.Context, params Params) (*Image, error) {
+	select {
+	case s.limitCh <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	defer func() {
 		<-s.limitCh
 	}()
-	return s.Server.Get(params)
+	return GetWithContext(ctx, s.Server, params)
 }